@@ -0,0 +1,321 @@
+// Package backup writes compressed and optionally encrypted copies of the
+// database, and keeps the last N of them.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	prefix    = "euperturbot-"
+	extension = ".db.gz"
+	// encrypted backups have this extension after extension
+	encryptedExtension = ".enc"
+	// with nanoseconds, backups made in the same second don't overwrite each other
+	timeFormat = "20060102-150405.000000000"
+)
+
+// magic starts the encrypted backups, followed by the salt, the nonce prefix
+// and the compressed database sealed with AES-256-GCM in chunks
+var magic = []byte("EUPBAK02")
+
+const (
+	saltSize   = 16
+	iterations = 200_000
+)
+
+var (
+	ErrPassphrase = errors.New("backup: the backup is encrypted and no passphrase was given")
+	ErrDecrypt    = errors.New("backup: wrong passphrase or corrupted backup")
+)
+
+// Source is the database being backed up
+type Source interface {
+	// Backup writes a consistent copy of the database to dest
+	Backup(ctx context.Context, dest string) error
+}
+
+// Name is the file name of a backup made at t
+func Name(t time.Time, encrypted bool) string {
+	name := prefix + t.UTC().Format(timeFormat) + extension
+	if encrypted {
+		name += encryptedExtension
+	}
+	return name
+}
+
+// Create backs up the database to a new file in dir and returns its path.
+// The copy is written to a temporary file first, so a failed backup never
+// leaves a partial file with the name of a backup.
+func Create(ctx context.Context, src Source, dir string, passphrase string, now time.Time) (string, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, Name(now, passphrase != ""))
+
+	raw := path + ".raw"
+	_ = os.Remove(raw)
+	defer os.Remove(raw)
+	err = src.Backup(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(raw)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	err = Write(out, in, passphrase)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return path, os.Rename(tmp, path)
+}
+
+// Write compresses the database read from src into w, and encrypts it if
+// passphrase is set
+func Write(w io.Writer, src io.Reader, passphrase string) error {
+	if passphrase == "" {
+		return compress(w, src)
+	}
+
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	_, err = rand.Read(prefix)
+	if err != nil {
+		return err
+	}
+
+	header := append(append(append([]byte{}, magic...), salt...), prefix...)
+	_, err = w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	sw := newSealWriter(w, aead, header, prefix)
+	err = compress(sw, src)
+	if err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+func compress(w io.Writer, src io.Reader) error {
+	zw := gzip.NewWriter(w)
+	_, err := io.Copy(zw, src)
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Read returns the database of a backup made by Write. passphrase is only
+// needed if the backup is encrypted. Encrypted backups are decrypted while they
+// are read, so a corrupted chunk fails the read with ErrDecrypt.
+func Read(r io.Reader, passphrase string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(magic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if !bytes.Equal(head, magic) {
+		return gzip.NewReader(br)
+	}
+	if passphrase == "" {
+		return nil, ErrPassphrase
+	}
+
+	header := make([]byte, len(magic)+saltSize+noncePrefixSize)
+	_, err = io.ReadFull(br, header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	salt := header[len(magic) : len(magic)+saltSize]
+	prefix := header[len(magic)+saltSize:]
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return gzip.NewReader(newOpenReader(br, aead, header, prefix))
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Rotate removes the oldest backups in dir, keeping the last keep of them,
+// and returns the removed paths. Other files are left alone.
+func Rotate(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isBackup(e.Name()) {
+			continue
+		}
+		backups = append(backups, e.Name())
+	}
+	if len(backups) <= keep {
+		return nil, nil
+	}
+
+	// the names sort by date
+	sort.Strings(backups)
+
+	removed := []string{}
+	errs := []error{}
+	for _, name := range backups[:len(backups)-keep] {
+		path := filepath.Join(dir, name)
+		err := os.Remove(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
+
+func isBackup(name string) bool {
+	_, ok := backupTime(name)
+	return ok
+}
+
+// backupTime returns when the backup with the name was made, or false if the
+// name is not of a backup
+func backupTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+	date := strings.TrimPrefix(name, prefix)
+	date = strings.TrimSuffix(date, encryptedExtension)
+	if !strings.HasSuffix(date, extension) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeFormat, strings.TrimSuffix(date, extension))
+	return t, err == nil
+}
+
+// Last returns when the newest backup in dir was made. It is the zero time if
+// there are no backups.
+func Last(dir string) (time.Time, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	last := time.Time{}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		t, ok := backupTime(e.Name())
+		if ok && t.After(last) {
+			last = t
+		}
+	}
+	return last, nil
+}
+
+// Extract writes the database in the backup src to dest
+func Extract(src string, dest string, passphrase string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r, err := Read(in, passphrase)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
+
+// IsCompressed tells if the file is a backup made by Write, instead of a plain
+// database
+func IsCompressed(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, len(magic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	head = head[:n]
+
+	gzipMagic := []byte{0x1f, 0x8b}
+	return bytes.Equal(head, magic) || bytes.HasPrefix(head, gzipMagic), nil
+}
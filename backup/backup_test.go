@@ -0,0 +1,349 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	data := bytes.Repeat([]byte("SQLite format 3\x00 dados "), 1000)
+
+	for _, passphrase := range []string{"", "segredo"} {
+		buf := &bytes.Buffer{}
+		err := Write(buf, bytes.NewReader(data), passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= len(data) {
+			t.Fatalf("%q: backup is not compressed: %d bytes", passphrase, buf.Len())
+		}
+		if passphrase != "" && bytes.Contains(buf.Bytes(), []byte("dados")) {
+			t.Fatal("encrypted backup has plain text")
+		}
+
+		r, err := Read(bytes.NewReader(buf.Bytes()), passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%q: read data differs from the written", passphrase)
+		}
+	}
+}
+
+func TestReadEncryptedErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := Write(buf, bytes.NewReader([]byte("dados")), "segredo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Read(bytes.NewReader(buf.Bytes()), "")
+	if !errors.Is(err, ErrPassphrase) {
+		t.Fatalf("no passphrase - want: %v, got: %v", ErrPassphrase, err)
+	}
+
+	_, err = Read(bytes.NewReader(buf.Bytes()), "errada")
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong passphrase - want: %v, got: %v", ErrDecrypt, err)
+	}
+
+	tampered := bytes.Clone(buf.Bytes())
+	tampered[len(tampered)-1] ^= 1
+	_, err = Read(bytes.NewReader(tampered), "segredo")
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("tampered - want: %v, got: %v", ErrDecrypt, err)
+	}
+}
+
+func TestWriteReadChunks(t *testing.T) {
+	// random data doesn't compress, so the backup has a few chunks
+	data := make([]byte, 3*chunkSize)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Write(buf, bytes.NewReader(data), "segredo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Read(bytes.NewReader(buf.Bytes()), "segredo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("read data differs from the written")
+	}
+
+	// cut right after the first chunk
+	headerSize := len(magic) + saltSize + noncePrefixSize
+	truncated := buf.Bytes()[:headerSize+chunkSize+16]
+	r, err = Read(bytes.NewReader(truncated), "segredo")
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("truncated - want: %v, got: %v", ErrDecrypt, err)
+	}
+}
+
+func TestReadTamperedChunks(t *testing.T) {
+	// random data doesn't compress, so the backup has a few chunks
+	data := make([]byte, 3*chunkSize)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Write(buf, bytes.NewReader(data), "segredo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize := len(magic) + saltSize + noncePrefixSize
+	sealedSize := chunkSize + 16
+	header := buf.Bytes()[:headerSize]
+	chunks := [][]byte{}
+	for rest := buf.Bytes()[headerSize:]; len(rest) > 0; {
+		n := sealedSize
+		if len(rest) < n {
+			n = len(rest)
+		}
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+	if len(chunks) < 4 {
+		t.Fatalf("chunks - want: at least 4, got: %d", len(chunks))
+	}
+
+	join := func(chunks ...[]byte) []byte {
+		return bytes.Join(append([][]byte{header}, chunks...), nil)
+	}
+	last := len(chunks) - 1
+
+	tests := []struct {
+		name   string
+		backup []byte
+	}{
+		{"reordered", join(chunks[1], chunks[0], chunks[2], chunks[last])},
+		{"middle chunk dropped", join(chunks[0], chunks[2], chunks[last])},
+		{"first chunk dropped", join(chunks[1:]...)},
+		{"last chunk dropped", join(chunks[:last]...)},
+		{"last chunk repeated", join(append(append([][]byte{}, chunks...), chunks[last])...)},
+		{"truncated inside a chunk", join(chunks[0], chunks[1][:100])},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := Read(bytes.NewReader(test.backup), "segredo")
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("err - want: %v, got: %v", ErrDecrypt, err)
+			}
+		})
+	}
+}
+
+type fileSource []byte
+
+func (s fileSource) Backup(ctx context.Context, dest string) error {
+	return os.WriteFile(dest, s, 0o600)
+}
+
+type failingSource struct{}
+
+func (failingSource) Backup(ctx context.Context, dest string) error {
+	_ = os.WriteFile(dest, []byte("pela metade"), 0o600)
+	return errors.New("disk full")
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	now := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+	path, err := Create(context.TODO(), fileSource("dados"), dir, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "euperturbot-20231114-221320.000000000.db.gz"); path != want {
+		t.Fatalf("path - want: %s, got: %s", want, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := Read(f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	if string(got) != "dados" {
+		t.Fatalf("content - want: %q, got: %q", "dados", got)
+	}
+
+	_, err = Create(context.TODO(), failingSource{}, dir, "", now.Add(time.Hour))
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("a failed backup left files behind: %v", entries)
+	}
+}
+
+func TestName(t *testing.T) {
+	now := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+	a := Name(now, false)
+	b := Name(now.Add(time.Millisecond), false)
+	if a == b {
+		t.Fatalf("backups in the same second have the same name: %s", a)
+	}
+	// the names sort by date
+	if a > b {
+		t.Fatalf("want: %s before %s", a, b)
+	}
+	if !isBackup(a) || !isBackup(Name(now, true)) {
+		t.Fatalf("%s is not a backup", a)
+	}
+}
+
+func TestLast(t *testing.T) {
+	dir := t.TempDir()
+
+	last, err := Last(filepath.Join(dir, "nope"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.IsZero() {
+		t.Fatalf("missing dir - want: zero time, got: %v", last)
+	}
+
+	now := time.Date(2023, 11, 14, 22, 13, 20, 5, time.UTC)
+	for _, name := range []string{Name(now.Add(-time.Hour), false), Name(now, true), "notas.txt"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last, err = Last(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Equal(now) {
+		t.Fatalf("last - want: %v, got: %v", now, last)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+	names := []string{}
+	for i := 0; i < 5; i++ {
+		name := Name(start.Add(time.Duration(i)*24*time.Hour), i%2 == 0)
+		names = append(names, name)
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not backups
+	for _, name := range []string{"notas.txt", "euperturbot-nope.db.gz"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := Rotate(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 3 {
+		t.Fatalf("removed - want: %d, got: %v", 3, removed)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := map[string]bool{}
+	for _, e := range entries {
+		left[e.Name()] = true
+	}
+	for _, name := range append(names[3:], "notas.txt", "euperturbot-nope.db.gz") {
+		if !left[name] {
+			t.Fatalf("%s should be kept", name)
+		}
+	}
+	if len(left) != 4 {
+		t.Fatalf("files left - want: %d, got: %v", 4, left)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.db")
+	err := os.WriteFile(plain, []byte("SQLite format 3\x00"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := Create(context.TODO(), fileSource("dados"), dir, "segredo", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]bool{plain: false, path: true} {
+		compressed, err := IsCompressed(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed != want {
+			t.Fatalf("%s compressed - want: %v, got: %v", file, want, compressed)
+		}
+	}
+
+	dest := filepath.Join(dir, "extracted.db")
+	err = Extract(path, dest, "errada")
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("wrong passphrase - want: %v, got: %v", ErrDecrypt, err)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		t.Fatal("failed extraction left the file behind")
+	}
+
+	err = Extract(path, dest, "segredo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(dest)
+	if string(got) != "dados" {
+		t.Fatalf("content - want: %q, got: %q", "dados", got)
+	}
+}
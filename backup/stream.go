@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// chunkSize is how much of the compressed database each sealed chunk has, so
+// backups are encrypted and decrypted without holding them in memory
+const chunkSize = 64 << 10
+
+// noncePrefixSize is the random part of the nonce. The rest of it is the
+// number of the chunk and a byte that marks the last one, so chunks can't be
+// reordered, and a backup cut at a chunk boundary doesn't decrypt.
+const noncePrefixSize = 7
+
+// chunkNonce returns the nonce of the n-th chunk
+func chunkNonce(nonce []byte, prefix []byte, n uint32, last bool) []byte {
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], n)
+	nonce[len(nonce)-1] = 0
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// sealWriter seals what is written to it in chunks. Close seals the last one.
+type sealWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	nonce  []byte
+	n      uint32
+	buf    []byte
+	out    []byte
+}
+
+func newSealWriter(w io.Writer, aead cipher.AEAD, header []byte, prefix []byte) *sealWriter {
+	return &sealWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		nonce:  make([]byte, aead.NonceSize()),
+		buf:    make([]byte, 0, chunkSize),
+	}
+}
+
+func (sw *sealWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed when more data comes, since the last
+		// one is sealed differently
+		if len(sw.buf) == chunkSize {
+			err := sw.seal(false)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(sw.buf[len(sw.buf):chunkSize], p)
+		sw.buf = sw.buf[:len(sw.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (sw *sealWriter) Close() error {
+	return sw.seal(true)
+}
+
+func (sw *sealWriter) seal(last bool) error {
+	nonce := chunkNonce(sw.nonce, sw.prefix, sw.n, last)
+	sw.out = sw.aead.Seal(sw.out[:0], nonce, sw.buf, sw.header)
+	sw.buf = sw.buf[:0]
+	sw.n++
+
+	_, err := sw.w.Write(sw.out)
+	return err
+}
+
+// openReader opens the chunks sealed by sealWriter
+type openReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	nonce  []byte
+	n      uint32
+	in     []byte
+	plain  []byte
+	done   bool
+}
+
+func newOpenReader(r *bufio.Reader, aead cipher.AEAD, header []byte, prefix []byte) *openReader {
+	return &openReader{
+		r:      r,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		nonce:  make([]byte, aead.NonceSize()),
+		in:     make([]byte, chunkSize+aead.Overhead()),
+	}
+}
+
+func (or *openReader) Read(p []byte) (int, error) {
+	for len(or.plain) == 0 {
+		if or.done {
+			return 0, io.EOF
+		}
+		err := or.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, or.plain)
+	or.plain = or.plain[n:]
+	return n, nil
+}
+
+// open reads and opens the next chunk. The last one is the one followed by
+// the end of the file.
+func (or *openReader) open() error {
+	n, err := io.ReadFull(or.r, or.in)
+	last := false
+	switch {
+	case err == nil:
+		_, err = or.r.Peek(1)
+		if errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		// the last chunk is missing
+		return ErrDecrypt
+	default:
+		return err
+	}
+
+	nonce := chunkNonce(or.nonce, or.prefix, or.n, last)
+	plain, err := or.aead.Open(or.in[:0], nonce, or.in[:n], or.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+	or.plain = plain
+	or.n++
+	or.done = last
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -27,23 +28,35 @@ type Service interface {
 	SendMessage(params SendMessageParams) (*Message, error)
 	EditMessageText(params EditMessageTextParams) (*Message, error)
 	AnswerInlineQuery(params AnswerInlineQueryParams) error
+	AnswerCallbackQuery(params AnswerCallbackQueryParams) error
+	SetMyCommands(params SetMyCommandsParams) error
 	SendDocument(params SendDocumentParams) error
+	GetFile(params GetFileParams) (*File, error)
+	DownloadFile(filePath string) ([]byte, error)
 }
 
 type service struct {
-	retry    util.Retry
-	token    string
-	username string
-	baseURL  string
-	client   http.Client
+	retry       util.Retry
+	token       string
+	username    string
+	baseURL     string
+	fileBaseURL string
+	client      http.Client
 }
 
+// AllowedUpdates are the kinds of updates the bot receives
+var AllowedUpdates = []string{"message", "edited_message", "poll", "poll_answer", "callback_query", "inline_query", "my_chat_member", "chat_member"}
+
+// bots can only download files up to 20MB
+const maxFileSize = 20 << 20
+
 var _ Service = &service{}
 
 func NewService(token string) Service {
 	return &service{
-		token:   token,
-		baseURL: "https://api.telegram.org/bot",
+		token:       token,
+		baseURL:     "https://api.telegram.org/bot",
+		fileBaseURL: "https://api.telegram.org/file/bot",
 		retry: util.Retry{
 			MaxAttempts: 3,
 			Delay:       time.Second,
@@ -112,7 +125,7 @@ func (s *service) GetMe() (*User, error) {
 }
 
 func (s *service) GetChatMember(params GetChatMemberParams) (*ChatMember, error) {
-	res, err := apiJSONRequest[ChatMember](s, "getMe", params)
+	res, err := apiJSONRequest[ChatMember](s, "getChatMember", params)
 	return &res.Result, err
 }
 
@@ -129,7 +142,7 @@ func (s *service) GetUpdatesChannel() chan Update {
 			params := GetUpdatesParams{
 				Offset:         updateID,
 				Timeout:        5,
-				AllowedUpdates: []string{"message", "poll", "poll_answer", "callback_query", "inline_query"},
+				AllowedUpdates: AllowedUpdates,
 			}
 			updates, err := s.GetUpdates(params)
 			if err != nil {
@@ -170,22 +183,36 @@ func (s *service) AnswerInlineQuery(params AnswerInlineQueryParams) error {
 	return err
 }
 
+func (s *service) AnswerCallbackQuery(params AnswerCallbackQueryParams) error {
+	_, err := apiJSONRequest[bool](s, "answerCallbackQuery", params)
+	return err
+}
+
+func (s *service) SetMyCommands(params SetMyCommandsParams) error {
+	_, err := apiJSONRequest[bool](s, "setMyCommands", params)
+	return err
+}
+
 func (s *service) SendDocument(params SendDocumentParams) error {
-	f, err := os.Open(params.FileName)
-	if err != nil {
-		return err
+	var content io.Reader = bytes.NewReader(params.Content)
+	if params.Content == nil {
+		f, err := os.Open(params.FileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		content = f
 	}
-	defer f.Close()
 
 	body := &bytes.Buffer{}
 	mw := multipart.NewWriter(body)
 
-	part, err := mw.CreateFormFile("document", params.FileName)
+	part, err := mw.CreateFormFile("document", filepath.Base(params.FileName))
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(part, f)
+	_, err = io.Copy(part, content)
 	if err != nil {
 		return err
 	}
@@ -195,6 +222,13 @@ func (s *service) SendDocument(params SendDocumentParams) error {
 		return err
 	}
 
+	if params.Caption != "" {
+		err = mw.WriteField("caption", params.Caption)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = mw.Close()
 	if err != nil {
 		return err
@@ -210,17 +244,49 @@ func (s *service) SendDocument(params SendDocumentParams) error {
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return err
+		return errors.New(s.hideToken(err.Error()))
 	}
 	defer resp.Body.Close()
 
-	var res Result[any]
-	err = json.NewDecoder(resp.Body).Decode(&res)
+	respBody, err := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return s.respError(resp, nil, respBody)
+	}
 	if err != nil {
 		return err
 	}
 
-	return nil
+	var res Result[any]
+	return json.Unmarshal(respBody, &res)
+}
+
+func (s *service) GetFile(params GetFileParams) (*File, error) {
+	res, err := apiJSONRequest[File](s, "getFile", params)
+	return &res.Result, err
+}
+
+func (s *service) DownloadFile(filePath string) ([]byte, error) {
+	u := s.fileBaseURL + s.token + "/" + filePath
+
+	resp, err := s.client.Get(u)
+	if err != nil {
+		return nil, errors.New(s.hideToken(err.Error()))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, s.respError(resp, nil, respBody)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFileSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxFileSize)
+	}
+	return b, nil
 }
 
 func (s *service) hideToken(str string) string {
@@ -0,0 +1,186 @@
+package bothandler
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// CommandFunc handles a command whose arguments were parsed according to its spec
+type CommandFunc func(s bot.Service, u bot.Update, args Args) error
+
+// NoArgs adapts a handler that doesn't read the command arguments
+func NoArgs(fn HandlerFunc) CommandFunc {
+	return func(s bot.Service, u bot.Update, args Args) error {
+		return fn(s, u)
+	}
+}
+
+// Args is a command message parsed according to the command spec
+type Args struct {
+	// Command is the command name, without the slash and the @bot suffix
+	Command string
+	// Raw is the text after the command, trimmed
+	Raw string
+	// Positional has the arguments that aren't flags, with quotes removed
+	Positional []string
+	// Flags has the value of each flag given. Flags without value have "".
+	Flags map[string]string
+	// Reply is the message the command replied to, if any
+	Reply *bot.Message
+
+	named map[string][]string
+}
+
+// Get returns the value of the named argument. Variadic values are joined by spaces.
+func (a Args) Get(name string) string {
+	return strings.Join(a.named[name], " ")
+}
+
+// List returns the values of a variadic or lines argument
+func (a Args) List(name string) []string {
+	return a.named[name]
+}
+
+func (a Args) Has(flag string) bool {
+	_, ok := a.Flags[flag]
+	return ok
+}
+
+// UsageError is returned when the command is used wrong. Its message is meant
+// to be shown to the user.
+type UsageError struct {
+	Spec   CommandSpec
+	Reason string
+}
+
+func (err UsageError) Error() string {
+	return err.Reason + "\nuso: " + err.Spec.Usage()
+}
+
+type token struct {
+	value  string
+	quoted bool
+	// start is where the token starts in Args.Raw
+	start int
+}
+
+// ParseArgs parses the command message. botUsername is removed from
+// commands like /cmd@bot. Arguments may be quoted with double quotes, and
+// flags like --name or --name=value are only parsed if the spec has flags.
+// Extra arguments are only an error if the spec declares arguments.
+func ParseArgs(spec CommandSpec, msg *bot.Message, botUsername string) (Args, error) {
+	args := Args{
+		Flags: map[string]string{},
+		Reply: msg.ReplyToMessage,
+		named: map[string][]string{},
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	cmd, rest := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		cmd, rest = text[:i], text[i:]
+	}
+
+	cmd = strings.TrimPrefix(cmd, "/")
+	if name, username, ok := strings.Cut(cmd, "@"); ok && strings.EqualFold(username, botUsername) {
+		cmd = name
+	}
+	args.Command = cmd
+	args.Raw = strings.TrimSpace(rest)
+
+	tokens := []token{}
+	for _, t := range tokenize(args.Raw) {
+		if len(spec.Flags) > 0 && !t.quoted && strings.HasPrefix(t.value, "--") {
+			name, value, _ := strings.Cut(strings.TrimPrefix(t.value, "--"), "=")
+			if _, ok := spec.findFlag(name); !ok {
+				return args, UsageError{Spec: spec, Reason: "opção desconhecida: --" + name}
+			}
+			args.Flags[name] = value
+			continue
+		}
+		tokens = append(tokens, t)
+		args.Positional = append(args.Positional, t.value)
+	}
+
+	i := 0
+	for _, arg := range spec.Args {
+		if i >= len(tokens) {
+			if !arg.Optional {
+				return args, UsageError{Spec: spec, Reason: "faltou " + arg.Name}
+			}
+			continue
+		}
+
+		switch {
+		case arg.Lines:
+			for _, line := range strings.Split(args.Raw[tokens[i].start:], "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					args.named[arg.Name] = append(args.named[arg.Name], line)
+				}
+			}
+			i = len(tokens)
+		case arg.Text:
+			args.named[arg.Name] = []string{args.Raw[tokens[i].start:]}
+			i = len(tokens)
+		case arg.Variadic:
+			for _, t := range tokens[i:] {
+				args.named[arg.Name] = append(args.named[arg.Name], t.value)
+			}
+			i = len(tokens)
+		default:
+			args.named[arg.Name] = []string{tokens[i].value}
+			i++
+		}
+	}
+
+	if len(spec.Args) > 0 && i < len(tokens) {
+		return args, UsageError{Spec: spec, Reason: "argumentos demais"}
+	}
+
+	if spec.Reply != "" && args.Reply == nil {
+		return args, UsageError{Spec: spec, Reason: spec.Reply}
+	}
+
+	return args, nil
+}
+
+// tokenize splits the text by spaces. Double quotes group words, and \" is a
+// literal quote inside them. An unterminated quote goes until the end.
+func tokenize(text string) []token {
+	tokens := []token{}
+
+	var cur *token
+	inQuotes := false
+	escaped := false
+	for i, r := range text {
+		if cur == nil {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			cur = &token{start: i}
+		}
+
+		switch {
+		case escaped:
+			cur.value += string(r)
+			escaped = false
+		case inQuotes && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			cur.quoted = true
+		case !inQuotes && unicode.IsSpace(r):
+			tokens = append(tokens, *cur)
+			cur = nil
+		default:
+			cur.value += string(r)
+		}
+	}
+	if cur != nil {
+		tokens = append(tokens, *cur)
+	}
+
+	return tokens
+}
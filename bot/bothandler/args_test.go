@@ -0,0 +1,181 @@
+package bothandler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestParseArgs(t *testing.T) {
+	audio := CommandSpec{
+		Name: "a",
+		Args: []Arg{
+			{Name: "nome"},
+			{Name: "tags", Optional: true, Variadic: true},
+		},
+	}
+	ask := CommandSpec{
+		Name: "ask",
+		Args: []Arg{{Name: "pergunta", Text: true}},
+	}
+	suba := CommandSpec{
+		Name: "suba",
+		Args: []Arg{{Name: "tópicos", Lines: true}},
+	}
+	flags := CommandSpec{
+		Name:  "cmd",
+		Flags: []Flag{{Name: "tudo"}, {Name: "dias", Value: "N"}},
+		Args:  []Arg{{Name: "x", Optional: true}},
+	}
+
+	tests := []struct {
+		name  string
+		spec  CommandSpec
+		text  string
+		get   map[string]string
+		list  map[string][]string
+		flags map[string]string
+	}{
+		{
+			name: "positional",
+			spec: audio,
+			text: "/a grito zoeira bom",
+			get:  map[string]string{"nome": "grito", "tags": "zoeira bom"},
+			list: map[string][]string{"tags": {"zoeira", "bom"}},
+		},
+		{
+			name: "bot username",
+			spec: audio,
+			text: "/a@EuPerturboBot grito",
+			get:  map[string]string{"nome": "grito"},
+		},
+		{
+			name: "quoted",
+			spec: audio,
+			text: `/a "grito alto" "a \"b\""`,
+			list: map[string][]string{"tags": {`a "b"`}},
+			get:  map[string]string{"nome": "grito alto"},
+		},
+		{
+			name: "unterminated quote",
+			spec: audio,
+			text: `/a "grito alto`,
+			get:  map[string]string{"nome": "grito alto"},
+		},
+		{
+			name: "text keeps spaces and newlines",
+			spec: ask,
+			text: "/ask@EuPerturboBot  quanto é\n 2  + 2?  ",
+			get:  map[string]string{"pergunta": "quanto é\n 2  + 2?"},
+		},
+		{
+			name: "text with apostrophe",
+			spec: ask,
+			text: `/ask what's "up`,
+			get:  map[string]string{"pergunta": `what's "up`},
+		},
+		{
+			name: "lines",
+			spec: suba,
+			text: "/suba futebol\n  xadrez \n\nvolei",
+			list: map[string][]string{"tópicos": {"futebol", "xadrez", "volei"}},
+		},
+		{
+			name: "command followed by newline",
+			spec: suba,
+			text: "/suba\nfutebol\nxadrez",
+			list: map[string][]string{"tópicos": {"futebol", "xadrez"}},
+		},
+		{
+			name:  "flags",
+			spec:  flags,
+			text:  "/cmd --tudo --dias=3 x",
+			get:   map[string]string{"x": "x"},
+			flags: map[string]string{"tudo": "", "dias": "3"},
+		},
+		{
+			name: "quoted flag is positional",
+			spec: flags,
+			text: `/cmd "--tudo"`,
+			get:  map[string]string{"x": "--tudo"},
+		},
+		{
+			name: "extra words without declared args",
+			spec: CommandSpec{Name: "lista"},
+			text: "/lista pls",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := ParseArgs(tt.spec, &bot.Message{Text: tt.text}, "euperturbobot")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if args.Command != tt.spec.Name {
+				t.Errorf("command - want: %s, got: %s", tt.spec.Name, args.Command)
+			}
+			for name, want := range tt.get {
+				if got := args.Get(name); got != want {
+					t.Errorf("%s - want: %q, got: %q", name, want, got)
+				}
+			}
+			for name, want := range tt.list {
+				if got := args.List(name); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s - want: %q, got: %q", name, want, got)
+				}
+			}
+			if tt.flags == nil {
+				tt.flags = map[string]string{}
+			}
+			if !reflect.DeepEqual(args.Flags, tt.flags) {
+				t.Errorf("flags - want: %v, got: %v", tt.flags, args.Flags)
+			}
+		})
+	}
+}
+
+func TestParseArgsUsageErrors(t *testing.T) {
+	spec := CommandSpec{
+		Name:  "aren",
+		Args:  []Arg{{Name: "nome"}, {Name: "novo"}},
+		Flags: []Flag{{Name: "forcar"}},
+	}
+	reply := CommandSpec{Name: "transcrever", Reply: "responda a uma mensagem de voz"}
+	saveAudio := CommandSpec{Name: "a", Reply: "responda ao áudio que quer salvar"}
+	forget := CommandSpec{Name: "esquecer", Reply: "responda à mensagem que quer esquecer"}
+
+	tests := []struct {
+		name string
+		spec CommandSpec
+		msg  *bot.Message
+		want string
+	}{
+		{"missing", spec, &bot.Message{Text: "/aren a"}, "faltou novo"},
+		{"too many", spec, &bot.Message{Text: "/aren a b c"}, "argumentos demais"},
+		{"unknown flag", spec, &bot.Message{Text: "/aren --x a b"}, "opção desconhecida: --x"},
+		{"missing reply", reply, &bot.Message{Text: "/transcrever"}, "responda a uma mensagem de voz"},
+		{"missing reply to audio", saveAudio, &bot.Message{Text: "/a"}, "responda ao áudio que quer salvar"},
+		{"missing reply to forget", forget, &bot.Message{Text: "/esquecer"}, "responda à mensagem que quer esquecer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseArgs(tt.spec, tt.msg, "bot")
+			var usageErr UsageError
+			if !errors.As(err, &usageErr) {
+				t.Fatalf("want UsageError, got: %v", err)
+			}
+			if usageErr.Reason != tt.want {
+				t.Fatalf("reason - want: %s, got: %s", tt.want, usageErr.Reason)
+			}
+		})
+	}
+
+	_, err := ParseArgs(reply, &bot.Message{Text: "/transcrever", ReplyToMessage: &bot.Message{}}, "bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
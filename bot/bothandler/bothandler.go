@@ -2,6 +2,7 @@ package bothandler
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"regexp"
 	"runtime/debug"
@@ -42,6 +43,10 @@ var AnyText CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	return u.Message != nil && u.Message.Text != ""
 }
 
+var AnyEditedMessage CriteriaFunc = func(s bot.Service, u bot.Update) bool {
+	return u.EditedMessage != nil
+}
+
 var AnyCommand CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	if u.Message == nil {
 		return false
@@ -67,27 +72,53 @@ var AnyCallbackQuery CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	return u.CallbackQuery != nil
 }
 
+var CallbackDataPrefix = func(prefix string) CriteriaFunc {
+	return func(s bot.Service, u bot.Update) bool {
+		return u.CallbackQuery != nil && strings.HasPrefix(u.CallbackQuery.Data, prefix)
+	}
+}
+
 var AnyInlineQuery CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	return u.InlineQuery != nil
 }
 
 type UpdateController struct {
-	source   <-chan bot.Update
-	bot      bot.Service
-	handlers []struct {
-		criteria CriteriaFunc
-		fn       HandlerFunc
-	}
+	source      <-chan bot.Update
+	bot         bot.Service
+	handlers    []handler
+	middlewares []Middleware
+	guards      map[Permission]Middleware
+	// Commands has the commands handled with HandleCommand
+	Commands *CommandRegistry
+	// Dispatcher runs the handlers. Updates with the same Key are queued.
+	Dispatcher *Dispatcher
+	Key        KeyFunc
+	// LogUpdates logs every update handled
+	LogUpdates bool
+}
+
+type handler struct {
+	criteria CriteriaFunc
+	fn       HandlerFunc
+	// middlewares run after the global ones, in order
 	middlewares []Middleware
 }
 
 func NewUpdateHandler(s bot.Service, source <-chan bot.Update) *UpdateController {
 	return &UpdateController{
-		source: source,
-		bot:    s,
+		source:   source,
+		bot:      s,
+		guards:   map[Permission]Middleware{},
+		Commands: NewCommandRegistry(),
+		// a chat rarely has more than a few updates waiting
+		Dispatcher: NewDispatcher(100, 10),
+		Key:        ChatKey,
 	}
 }
 
+// Middleware adds a middleware that runs for every handler, if the update matches
+// all criterias. Middlewares run in the order they were added, and one can stop
+// the update from reaching the handler by not calling next.
 func (uc *UpdateController) Middleware(mw Middleware, criterias ...CriteriaFunc) {
 	criteria := func(s bot.Service, u bot.Update) bool {
 		for _, c := range criterias {
@@ -111,60 +142,100 @@ func (uc *UpdateController) Middleware(mw Middleware, criterias ...CriteriaFunc)
 	uc.middlewares = append(uc.middlewares, _mw)
 }
 
-func (uh *UpdateController) Handle(criteria CriteriaFunc, fn func(s bot.Service, u bot.Update) error) {
-	uh.handlers = append(uh.handlers, struct {
-		criteria CriteriaFunc
-		fn       HandlerFunc
-	}{
-		criteria,
-		fn,
+// Handle calls fn for the updates that match the criteria. The middlewares
+// only apply to this handler, and run after the global ones.
+func (uh *UpdateController) Handle(criteria CriteriaFunc, fn func(s bot.Service, u bot.Update) error, middlewares ...Middleware) {
+	uh.handlers = append(uh.handlers, handler{
+		criteria:    criteria,
+		fn:          fn,
+		middlewares: middlewares,
 	})
 }
 
+// chain wraps the handler with the global middlewares and then its own, so the
+// first one added is the first one to run
+func (uh *UpdateController) chain(h handler) HandlerFunc {
+	fn := h.fn
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		fn = h.middlewares[i](fn)
+	}
+	for i := len(uh.middlewares) - 1; i >= 0; i-- {
+		fn = uh.middlewares[i](fn)
+	}
+	return fn
+}
+
+// Guard sets the middleware that enforces the permission on the commands
+// handled with HandleCommand
+func (uh *UpdateController) Guard(p Permission, mw Middleware) {
+	uh.guards[p] = mw
+}
+
+// HandleCommand registers the command and handles it, enforcing its permission
+// with the guard set for it. It panics if the permission has no guard.
+// Usage errors are replied to the user.
+func (uh *UpdateController) HandleCommand(spec CommandSpec, cmdFn CommandFunc) {
+	fn := func(s bot.Service, u bot.Update) error {
+		args, err := ParseArgs(spec, u.Message, s.Username())
+		if err != nil {
+			return Reply{
+				Text: err.Error(),
+			}
+		}
+		return cmdFn(s, u, args)
+	}
+
+	middlewares := []Middleware{}
+	if spec.Permission != PermissionAnyone {
+		guard, ok := uh.guards[spec.Permission]
+		if !ok {
+			panic(fmt.Sprintf("bothandler: no guard for the permission of /%s", spec.Name))
+		}
+		middlewares = append(middlewares, guard)
+	}
+
+	uh.Commands.Register(spec)
+	uh.Handle(Command(spec.Name), fn, middlewares...)
+}
+
+// Start handles the updates until the source is closed. The updates with the
+// same Key are handled in order, one at a time.
 func (uh *UpdateController) Start() {
-	limit := make(chan struct{}, 10)
 	for update := range uh.source {
-		for _, handler := range uh.handlers {
-			handler := handler
-			update := update
-			if !handler.criteria(uh.bot, update) {
-				continue
-			}
+		update := update
+		uh.Dispatcher.Dispatch(uh.Key(update), func() {
+			uh.handle(update)
+		})
+	}
+	uh.Dispatcher.Wait()
+}
+
+// handle runs the first handler that matches the update
+func (uh *UpdateController) handle(update bot.Update) {
+	for _, handler := range uh.handlers {
+		if !handler.criteria(uh.bot, update) {
+			continue
+		}
 
-			fn := handler.fn
-			for _, mw := range uh.middlewares {
-				fn = mw(handler.fn)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Print("handler panic recovered: ", r)
+				debug.PrintStack()
 			}
+		}()
+
+		if uh.LogUpdates {
+			log.Print(update)
+		}
+		err := uh.chain(handler)(uh.bot, update)
 
-			limit <- struct{}{}
-			go func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Print("handler panic recovered: ", r)
-						debug.PrintStack()
-					}
-				}()
-				defer func() {
-					<-limit
-				}()
-				log.Print(update)
-				err := fn(uh.bot, update)
-
-				var reply Reply
-				if errors.As(err, &reply) {
-					_, err = uh.bot.SendMessage(bot.SendMessageParams{
-						ChatID:                   update.Message.Chat.ID,
-						ReplyToMessageID:         update.Message.MessageID,
-						AllowSendingWithoutReply: true,
-						Text:                     reply.Text,
-						ParseMode:                reply.ParseMode,
-					})
-				}
-				if err != nil {
-					log.Print(err)
-				}
-			}()
-			break
+		var reply Reply
+		if errors.As(err, &reply) {
+			err = ReplyTo(uh.bot, update, reply)
+		}
+		if err != nil {
+			log.Print(err)
 		}
+		return
 	}
 }
@@ -0,0 +1,141 @@
+package bothandler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var calls []string
+
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(s bot.Service, u bot.Update) error {
+				calls = append(calls, name)
+				return next(s, u)
+			}
+		}
+	}
+	abort := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(s bot.Service, u bot.Update) error {
+				calls = append(calls, name)
+				return errors.New("aborted")
+			}
+		}
+	}
+	never := func(s bot.Service, u bot.Update) bool {
+		return false
+	}
+
+	type globalMiddleware struct {
+		mw       Middleware
+		criteria []CriteriaFunc
+	}
+
+	tests := []struct {
+		name    string
+		global  []globalMiddleware
+		local   []Middleware
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "no middlewares",
+			want: []string{"handler"},
+		},
+		{
+			name:   "global in registration order",
+			global: []globalMiddleware{{mw: record("a")}, {mw: record("b")}, {mw: record("c")}},
+			want:   []string{"a", "b", "c", "handler"},
+		},
+		{
+			name:   "global before local",
+			global: []globalMiddleware{{mw: record("global")}},
+			local:  []Middleware{record("local1"), record("local2")},
+			want:   []string{"global", "local1", "local2", "handler"},
+		},
+		{
+			name:   "criteria not matched skips the middleware",
+			global: []globalMiddleware{{mw: record("a"), criteria: []CriteriaFunc{never}}, {mw: record("b")}},
+			want:   []string{"b", "handler"},
+		},
+		{
+			name:    "global abort short circuits",
+			global:  []globalMiddleware{{mw: record("a")}, {mw: abort("stop")}, {mw: record("c")}},
+			local:   []Middleware{record("local")},
+			want:    []string{"a", "stop"},
+			wantErr: true,
+		},
+		{
+			name:    "local abort short circuits",
+			global:  []globalMiddleware{{mw: record("global")}},
+			local:   []Middleware{abort("stop"), record("local")},
+			want:    []string{"global", "stop"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+
+			uh := NewUpdateHandler(&fakeService{}, nil)
+			for _, g := range tt.global {
+				uh.Middleware(g.mw, g.criteria...)
+			}
+			uh.Handle(AnyMessage, func(s bot.Service, u bot.Update) error {
+				calls = append(calls, "handler")
+				return nil
+			}, tt.local...)
+
+			err := uh.chain(uh.handlers[0])(uh.bot, bot.Update{Message: &bot.Message{}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err - want error: %v, got: %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Fatalf("calls - want: %v, got: %v", tt.want, calls)
+			}
+		})
+	}
+}
+
+func TestHandleCommandGuardRunsBeforeParsing(t *testing.T) {
+	var calls []string
+
+	uh := NewUpdateHandler(&fakeService{}, nil)
+	uh.Middleware(func(next HandlerFunc) HandlerFunc {
+		return func(s bot.Service, u bot.Update) error {
+			calls = append(calls, "global")
+			return next(s, u)
+		}
+	})
+	uh.Guard(PermissionAdmin, func(next HandlerFunc) HandlerFunc {
+		return func(s bot.Service, u bot.Update) error {
+			calls = append(calls, "guard")
+			return Reply{Text: "denied"}
+		}
+	})
+	uh.HandleCommand(CommandSpec{
+		Name:       "cmd",
+		Args:       []Arg{{Name: "x"}},
+		Permission: PermissionAdmin,
+	}, func(s bot.Service, u bot.Update, args Args) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	// missing the required argument, but the guard denies it first
+	err := uh.chain(uh.handlers[0])(uh.bot, bot.Update{Message: &bot.Message{Text: "/cmd"}})
+
+	var reply Reply
+	if !errors.As(err, &reply) || reply.Text != "denied" {
+		t.Fatalf("err - want: denied, got: %v", err)
+	}
+	if want := []string{"global", "guard"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls - want: %v, got: %v", want, calls)
+	}
+}
@@ -0,0 +1,185 @@
+package bothandler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// Permission is who can run a command
+type Permission int
+
+const (
+	PermissionAnyone Permission = iota
+	// PermissionAdmin is for chat admins. Everyone is admin in private chats.
+	PermissionAdmin
+	// PermissionGod is only for the bot owner
+	PermissionGod
+)
+
+// Chats is where a command is listed in telegram's command menu
+type Chats int
+
+const (
+	ChatsAll Chats = iota
+	ChatsPrivate
+	ChatsGroup
+)
+
+// Arg describes an argument of a command
+type Arg struct {
+	Name        string
+	Description string
+	Optional    bool
+	// Variadic takes the rest of the arguments
+	Variadic bool
+	// Text takes the rest of the text as is, with spaces and newlines
+	Text bool
+	// Lines takes the rest of the text, one value per line
+	Lines bool
+}
+
+// Flag describes an option like --name or --name=value
+type Flag struct {
+	Name        string
+	Description string
+	// Value names the value the flag takes. Flags without it are booleans.
+	Value string
+}
+
+type CommandSpec struct {
+	// Name is the command without the slash, e.g. "suba"
+	Name        string
+	Description string
+	Args        []Arg
+	Flags       []Flag
+	// Reply is set when the command must reply to a message. It tells the user
+	// what to reply to, e.g. "responda a uma mensagem de voz"
+	Reply      string
+	Permission Permission
+	Chats      Chats
+	// Hidden commands are not listed in /help nor in telegram's command menu
+	Hidden bool
+}
+
+// Usage returns how the command is used, e.g. "/a <nome> [tags...]"
+func (c CommandSpec) Usage() string {
+	usage := "/" + c.Name
+	for _, flag := range c.Flags {
+		if flag.Value != "" {
+			usage += " [--" + flag.Name + "=" + flag.Value + "]"
+		} else {
+			usage += " [--" + flag.Name + "]"
+		}
+	}
+	for _, arg := range c.Args {
+		name := arg.Name
+		if arg.Variadic || arg.Text || arg.Lines {
+			name += "..."
+		}
+		if arg.Optional {
+			usage += " [" + name + "]"
+		} else {
+			usage += " <" + name + ">"
+		}
+	}
+	return usage
+}
+
+func (c CommandSpec) findFlag(name string) (Flag, bool) {
+	for _, f := range c.Flags {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// CommandRegistry keeps the specs of the commands, in the order they were registered.
+// It is meant to be filled at startup, before the updates are handled.
+type CommandRegistry struct {
+	commands []CommandSpec
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{}
+}
+
+// Register adds the command. It panics if a command with the same name exists.
+func (r *CommandRegistry) Register(spec CommandSpec) {
+	if _, ok := r.Find(spec.Name); ok {
+		panic(fmt.Sprintf("bothandler: command /%s registered twice", spec.Name))
+	}
+	r.commands = append(r.commands, spec)
+}
+
+func (r *CommandRegistry) Find(name string) (CommandSpec, bool) {
+	name = strings.TrimPrefix(name, "/")
+	for _, c := range r.commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return CommandSpec{}, false
+}
+
+// Commands returns the commands that are not hidden
+func (r *CommandRegistry) Commands() []CommandSpec {
+	commands := []CommandSpec{}
+	for _, c := range r.commands {
+		if !c.Hidden {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+// BotCommands returns the commands shown in telegram's menu for the scope,
+// one of the bot.BotCommandScope* constants
+func (r *CommandRegistry) BotCommands(scope string) []bot.BotCommand {
+	commands := []bot.BotCommand{}
+	for _, c := range r.Commands() {
+		if !c.listedIn(scope) {
+			continue
+		}
+		commands = append(commands, bot.BotCommand{
+			Command:     c.Name,
+			Description: c.Description,
+		})
+	}
+	return commands
+}
+
+func (c CommandSpec) listedIn(scope string) bool {
+	switch scope {
+	case bot.BotCommandScopeAllPrivateChats:
+		return c.Chats != ChatsGroup && c.Permission <= PermissionAdmin
+	case bot.BotCommandScopeAllGroupChats:
+		return c.Chats != ChatsPrivate && c.Permission == PermissionAnyone
+	case bot.BotCommandScopeAllChatAdministrators:
+		return c.Chats != ChatsPrivate && c.Permission <= PermissionAdmin
+	}
+	return false
+}
+
+// Sync sets telegram's command menu of each scope
+func (r *CommandRegistry) Sync(s bot.Service) error {
+	scopes := []string{
+		bot.BotCommandScopeAllPrivateChats,
+		bot.BotCommandScopeAllGroupChats,
+		bot.BotCommandScopeAllChatAdministrators,
+	}
+	for _, scope := range scopes {
+		err := s.SetMyCommands(bot.SetMyCommandsParams{
+			Commands: r.BotCommands(scope),
+			Scope: bot.BotCommandScope{
+				Type: scope,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("set commands of %s: %w", scope, err)
+		}
+	}
+	return nil
+}
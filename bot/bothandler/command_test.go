@@ -0,0 +1,133 @@
+package bothandler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestCommandSpecUsage(t *testing.T) {
+	tests := []struct {
+		args []Arg
+		want string
+	}{
+		{nil, "/cmd"},
+		{[]Arg{{Name: "nome"}}, "/cmd <nome>"},
+		{[]Arg{{Name: "nome"}, {Name: "tags", Optional: true, Variadic: true}}, "/cmd <nome> [tags...]"},
+		{[]Arg{{Name: "termos", Variadic: true}}, "/cmd <termos...>"},
+	}
+
+	for _, tt := range tests {
+		got := CommandSpec{Name: "cmd", Args: tt.args}.Usage()
+		if got != tt.want {
+			t.Errorf("want: %s, got: %s", tt.want, got)
+		}
+	}
+}
+
+func TestCommandRegistryBotCommands(t *testing.T) {
+	r := NewCommandRegistry()
+	r.Register(CommandSpec{Name: "anyone", Description: "anyone"})
+	r.Register(CommandSpec{Name: "admin", Description: "admin", Permission: PermissionAdmin})
+	r.Register(CommandSpec{Name: "god", Description: "god", Permission: PermissionGod})
+	r.Register(CommandSpec{Name: "group", Description: "group", Chats: ChatsGroup})
+	r.Register(CommandSpec{Name: "private", Description: "private", Chats: ChatsPrivate})
+	r.Register(CommandSpec{Name: "hidden", Description: "hidden", Hidden: true})
+
+	tests := []struct {
+		scope string
+		want  []string
+	}{
+		{bot.BotCommandScopeAllPrivateChats, []string{"anyone", "admin", "private"}},
+		{bot.BotCommandScopeAllGroupChats, []string{"anyone", "group"}},
+		{bot.BotCommandScopeAllChatAdministrators, []string{"anyone", "admin", "group"}},
+	}
+
+	for _, tt := range tests {
+		names := []string{}
+		for _, c := range r.BotCommands(tt.scope) {
+			names = append(names, c.Command)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s - want: %v, got: %v", tt.scope, tt.want, names)
+		}
+	}
+}
+
+func TestCommandRegistryRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic")
+		}
+	}()
+
+	r := NewCommandRegistry()
+	r.Register(CommandSpec{Name: "cmd"})
+	r.Register(CommandSpec{Name: "cmd"})
+}
+
+type fakeService struct {
+	bot.Service
+	setCommands     []bot.SetMyCommandsParams
+	messages        []bot.SendMessageParams
+	callbackAnswers []bot.AnswerCallbackQueryParams
+	inlineAnswers   []bot.AnswerInlineQueryParams
+}
+
+func (s *fakeService) SendMessage(params bot.SendMessageParams) (*bot.Message, error) {
+	s.messages = append(s.messages, params)
+	return &bot.Message{}, nil
+}
+
+func (s *fakeService) AnswerCallbackQuery(params bot.AnswerCallbackQueryParams) error {
+	s.callbackAnswers = append(s.callbackAnswers, params)
+	return nil
+}
+
+func (s *fakeService) AnswerInlineQuery(params bot.AnswerInlineQueryParams) error {
+	s.inlineAnswers = append(s.inlineAnswers, params)
+	return nil
+}
+
+func (s *fakeService) SetMyCommands(params bot.SetMyCommandsParams) error {
+	s.setCommands = append(s.setCommands, params)
+	return nil
+}
+
+func TestCommandRegistrySync(t *testing.T) {
+	r := NewCommandRegistry()
+	r.Register(CommandSpec{Name: "cmd", Description: "cmd"})
+
+	s := &fakeService{}
+	err := r.Sync(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scopes := []string{}
+	for _, p := range s.setCommands {
+		scopes = append(scopes, p.Scope.Type)
+	}
+	want := []string{
+		bot.BotCommandScopeAllPrivateChats,
+		bot.BotCommandScopeAllGroupChats,
+		bot.BotCommandScopeAllChatAdministrators,
+	}
+	if !reflect.DeepEqual(scopes, want) {
+		t.Fatalf("scopes - want: %v, got: %v", want, scopes)
+	}
+}
+
+func TestHandleCommandRequiresGuard(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic")
+		}
+	}()
+
+	uh := NewUpdateHandler(&fakeService{}, nil)
+	uh.HandleCommand(CommandSpec{Name: "cmd", Permission: PermissionAdmin}, func(s bot.Service, u bot.Update, args Args) error {
+		return nil
+	})
+}
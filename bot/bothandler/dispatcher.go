@@ -0,0 +1,174 @@
+package bothandler
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// KeyFunc returns the key of the queue the update goes to. Updates with the
+// same key are handled in order. An empty key means the update has no order.
+type KeyFunc func(u bot.Update) string
+
+// ChatKey orders the updates of each chat. Poll answers have no chat, so they
+// are ordered per user. Inline queries have no order, since a new query from
+// the user must be able to cancel the previous one.
+func ChatKey(u bot.Update) string {
+	if chat := UpdateChat(u); chat != nil {
+		return "chat:" + strconv.FormatInt(chat.ID, 10)
+	}
+	if u.PollAnswer != nil {
+		return "user:" + strconv.FormatInt(u.PollAnswer.User.ID, 10)
+	}
+	return ""
+}
+
+// ChatUserKey orders the updates of each user in each chat, so different users
+// of the same chat are handled concurrently
+func ChatUserKey(u bot.Update) string {
+	key := ChatKey(u)
+	if UpdateChat(u) == nil {
+		return key
+	}
+	if from := UpdateFrom(u); from != nil {
+		key += ":user:" + strconv.FormatInt(from.ID, 10)
+	}
+	return key
+}
+
+// Dispatcher runs the jobs with the same key in the order they were dispatched,
+// and jobs with different keys concurrently. Each key has a bounded queue, and
+// Dispatch blocks while the queue of the key is full.
+type Dispatcher struct {
+	queueSize int
+	// limits how many jobs run at the same time
+	running chan struct{}
+
+	mut        *sync.Mutex
+	queues     map[string]*keyQueue
+	pending    int
+	maxPending int
+	wg         *sync.WaitGroup
+}
+
+type keyQueue struct {
+	jobs chan func()
+	// pending counts the jobs dispatched and not finished, including the ones
+	// waiting for room in the queue
+	pending int
+}
+
+type DispatcherStats struct {
+	// Keys is how many keys have pending jobs
+	Keys int
+	// Pending is how many jobs are waiting or running
+	Pending int
+	// MaxPending is the highest Pending seen
+	MaxPending int
+	// Depths has the pending jobs of each key
+	Depths map[string]int
+}
+
+func NewDispatcher(queueSize int, concurrency int) *Dispatcher {
+	return &Dispatcher{
+		queueSize: queueSize,
+		running:   make(chan struct{}, concurrency),
+		mut:       new(sync.Mutex),
+		queues:    map[string]*keyQueue{},
+		wg:        new(sync.WaitGroup),
+	}
+}
+
+// Dispatch queues the job. Jobs with an empty key don't wait for any other.
+func (d *Dispatcher) Dispatch(key string, job func()) {
+	d.wg.Add(1)
+
+	if key == "" {
+		d.mut.Lock()
+		d.addPending(1)
+		d.mut.Unlock()
+
+		go func() {
+			defer d.wg.Done()
+			d.run(job)
+
+			d.mut.Lock()
+			d.addPending(-1)
+			d.mut.Unlock()
+		}()
+		return
+	}
+
+	d.mut.Lock()
+	q, ok := d.queues[key]
+	if !ok {
+		q = &keyQueue{
+			jobs: make(chan func(), d.queueSize),
+		}
+		d.queues[key] = q
+		go d.work(key, q)
+	}
+	q.pending++
+	d.addPending(1)
+	d.mut.Unlock()
+
+	// blocks while the queue is full
+	q.jobs <- job
+}
+
+// work runs the jobs of the key until there are none pending
+func (d *Dispatcher) work(key string, q *keyQueue) {
+	for job := range q.jobs {
+		d.run(job)
+		d.wg.Done()
+
+		d.mut.Lock()
+		q.pending--
+		d.addPending(-1)
+		if q.pending == 0 {
+			// nobody can be sending to this queue, since senders count as pending
+			delete(d.queues, key)
+			d.mut.Unlock()
+			return
+		}
+		d.mut.Unlock()
+	}
+}
+
+func (d *Dispatcher) run(job func()) {
+	d.running <- struct{}{}
+	defer func() {
+		<-d.running
+	}()
+	job()
+}
+
+// addPending must be called with the lock held
+func (d *Dispatcher) addPending(n int) {
+	d.pending += n
+	if d.pending > d.maxPending {
+		d.maxPending = d.pending
+	}
+}
+
+// Wait blocks until all dispatched jobs finish
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) Stats() DispatcherStats {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	stats := DispatcherStats{
+		Keys:       len(d.queues),
+		Pending:    d.pending,
+		MaxPending: d.maxPending,
+		Depths:     map[string]int{},
+	}
+	for key, q := range d.queues {
+		stats.Depths[key] = q.pending
+	}
+	return stats
+}
@@ -0,0 +1,242 @@
+package bothandler
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestDispatcherOrdersJobsPerKey(t *testing.T) {
+	const keys = 20
+	const jobs = 200
+
+	d := NewDispatcher(8, 4)
+
+	mut := sync.Mutex{}
+	got := map[string][]int{}
+
+	wg := sync.WaitGroup{}
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprint("chat:", k)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < jobs; i++ {
+				i := i
+				d.Dispatch(key, func() {
+					mut.Lock()
+					got[key] = append(got[key], i)
+					mut.Unlock()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	d.Wait()
+
+	for key, seq := range got {
+		if len(seq) != jobs {
+			t.Fatalf("%s jobs - want: %d, got: %d", key, jobs, len(seq))
+		}
+		for i, v := range seq {
+			if v != i {
+				t.Fatalf("%s job %d - want: %d, got: %d", key, i, i, v)
+			}
+		}
+	}
+
+	stats := d.Stats()
+	if stats.Keys != 0 || stats.Pending != 0 {
+		t.Fatalf("stats after wait - want: 0 keys and 0 pending, got: %+v", stats)
+	}
+}
+
+func TestDispatcherRunsKeysConcurrently(t *testing.T) {
+	d := NewDispatcher(1, 2)
+
+	block := make(chan struct{})
+	d.Dispatch("a", func() {
+		<-block
+	})
+
+	done := make(chan struct{})
+	d.Dispatch("b", func() {
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job of key b waited for key a")
+	}
+
+	close(block)
+	d.Wait()
+}
+
+func TestDispatcherSerializesSameKey(t *testing.T) {
+	d := NewDispatcher(10, 10)
+
+	running := 0
+	maxRunning := 0
+	mut := sync.Mutex{}
+	for i := 0; i < 10; i++ {
+		d.Dispatch("a", func() {
+			mut.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mut.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mut.Lock()
+			running--
+			mut.Unlock()
+		})
+	}
+	d.Wait()
+
+	if maxRunning != 1 {
+		t.Fatalf("max jobs running - want: 1, got: %d", maxRunning)
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	d := NewDispatcher(2, 1)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	d.Dispatch("a", func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	// fills the queue while the first job runs
+	d.Dispatch("a", func() {})
+	d.Dispatch("a", func() {})
+
+	dispatched := make(chan struct{})
+	go func() {
+		d.Dispatch("a", func() {})
+		close(dispatched)
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("dispatch with the queue full didn't block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stats := d.Stats()
+	if stats.Depths["a"] != 4 {
+		t.Fatalf("depth of a - want: 4, got: %d", stats.Depths["a"])
+	}
+
+	close(block)
+	<-dispatched
+	d.Wait()
+
+	stats = d.Stats()
+	if stats.MaxPending != 4 {
+		t.Fatalf("max pending - want: 4, got: %d", stats.MaxPending)
+	}
+	if len(stats.Depths) != 0 {
+		t.Fatalf("depths after wait - want: empty, got: %v", stats.Depths)
+	}
+}
+
+func TestChatKey(t *testing.T) {
+	chat := &bot.Chat{ID: 10}
+	user := &bot.User{ID: 20}
+
+	tests := []struct {
+		name   string
+		update bot.Update
+		want   string
+		// wantUser is the ChatUserKey
+		wantUser string
+	}{
+		{
+			name:     "message",
+			update:   bot.Update{Message: &bot.Message{Chat: chat, From: user}},
+			want:     "chat:10",
+			wantUser: "chat:10:user:20",
+		},
+		{
+			name:     "callback query",
+			update:   bot.Update{CallbackQuery: &bot.CallbackQuery{From: user, Message: &bot.Message{Chat: chat}}},
+			want:     "chat:10",
+			wantUser: "chat:10:user:20",
+		},
+		{
+			name:     "poll answer",
+			update:   bot.Update{PollAnswer: &bot.PollAnswer{User: *user}},
+			want:     "user:20",
+			wantUser: "user:20",
+		},
+		{
+			name:     "inline query",
+			update:   bot.Update{InlineQuery: &bot.InlineQuery{From: user}},
+			want:     "",
+			wantUser: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ChatKey(test.update); got != test.want {
+				t.Fatalf("ChatKey - want: %q, got: %q", test.want, got)
+			}
+			if got := ChatUserKey(test.update); got != test.wantUser {
+				t.Fatalf("ChatUserKey - want: %q, got: %q", test.wantUser, got)
+			}
+		})
+	}
+}
+
+func TestStartHandlesChatInOrder(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeService{}, source)
+
+	mut := sync.Mutex{}
+	got := map[int64][]int{}
+	uh.Handle(AnyMessage, func(s bot.Service, u bot.Update) error {
+		mut.Lock()
+		defer mut.Unlock()
+		got[u.Message.Chat.ID] = append(got[u.Message.Chat.ID], u.Message.MessageID)
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		uh.Start()
+		close(done)
+	}()
+
+	for i := 0; i < 100; i++ {
+		for chatID := int64(1); chatID <= 3; chatID++ {
+			source <- bot.Update{
+				Message: &bot.Message{
+					MessageID: i,
+					Chat:      &bot.Chat{ID: chatID},
+				},
+			}
+		}
+	}
+	close(source)
+	<-done
+
+	for chatID, ids := range got {
+		for i, id := range ids {
+			if id != i {
+				t.Fatalf("chat %d message %d - want: %d, got: %d", chatID, i, i, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package bothandler
+
+import (
+	"errors"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+type MessageFunc func(s bot.Service, msg *bot.Message) error
+type CallbackFunc func(s bot.Service, cq *bot.CallbackQuery) error
+type InlineFunc func(s bot.Service, q *bot.InlineQuery) error
+type PollAnswerFunc func(s bot.Service, answer *bot.PollAnswer) error
+
+// ChatMemberFunc handles changes in the membership of a chat, both of the bot
+// itself and of other members
+type ChatMemberFunc func(s bot.Service, m *bot.ChatMemberUpdated) error
+
+var AnyPollAnswer CriteriaFunc = func(s bot.Service, u bot.Update) bool {
+	return u.PollAnswer != nil
+}
+
+var AnyChatMember CriteriaFunc = func(s bot.Service, u bot.Update) bool {
+	return u.ChatMember != nil || u.MyChatMember != nil
+}
+
+// ofKind matches the updates of the kind that match the criteria. A nil
+// criteria matches all of them.
+func ofKind(kind CriteriaFunc, criteria CriteriaFunc) CriteriaFunc {
+	if criteria == nil {
+		return kind
+	}
+	return And(kind, criteria)
+}
+
+// HandleMessage calls fn for the messages that match the criteria
+func (uh *UpdateController) HandleMessage(criteria CriteriaFunc, fn MessageFunc, middlewares ...Middleware) {
+	uh.Handle(ofKind(AnyMessage, criteria), func(s bot.Service, u bot.Update) error {
+		return fn(s, u.Message)
+	}, middlewares...)
+}
+
+// HandleCallback calls fn for the callback queries that match the criteria
+func (uh *UpdateController) HandleCallback(criteria CriteriaFunc, fn CallbackFunc, middlewares ...Middleware) {
+	uh.Handle(ofKind(AnyCallbackQuery, criteria), func(s bot.Service, u bot.Update) error {
+		return fn(s, u.CallbackQuery)
+	}, middlewares...)
+}
+
+// HandleInline calls fn for the inline queries that match the criteria
+func (uh *UpdateController) HandleInline(criteria CriteriaFunc, fn InlineFunc, middlewares ...Middleware) {
+	uh.Handle(ofKind(AnyInlineQuery, criteria), func(s bot.Service, u bot.Update) error {
+		return fn(s, u.InlineQuery)
+	}, middlewares...)
+}
+
+// HandlePollAnswer calls fn for the answers to non anonymous polls sent by the bot
+func (uh *UpdateController) HandlePollAnswer(criteria CriteriaFunc, fn PollAnswerFunc, middlewares ...Middleware) {
+	uh.Handle(ofKind(AnyPollAnswer, criteria), func(s bot.Service, u bot.Update) error {
+		return fn(s, u.PollAnswer)
+	}, middlewares...)
+}
+
+// HandleChatMember calls fn for my_chat_member and chat_member updates
+func (uh *UpdateController) HandleChatMember(criteria CriteriaFunc, fn ChatMemberFunc, middlewares ...Middleware) {
+	uh.Handle(ofKind(AnyChatMember, criteria), func(s bot.Service, u bot.Update) error {
+		if u.ChatMember != nil {
+			return fn(s, u.ChatMember)
+		}
+		return fn(s, u.MyChatMember)
+	}, middlewares...)
+}
+
+// UpdateChat returns the chat where the update happened, or nil for updates
+// outside chats, like inline queries and poll answers
+func UpdateChat(u bot.Update) *bot.Chat {
+	switch {
+	case u.Message != nil:
+		return u.Message.Chat
+	case u.EditedMessage != nil:
+		return u.EditedMessage.Chat
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
+		return u.CallbackQuery.Message.Chat
+	case u.ChatMember != nil:
+		return &u.ChatMember.Chat
+	case u.MyChatMember != nil:
+		return &u.MyChatMember.Chat
+	}
+	return nil
+}
+
+// UpdateFrom returns the user that caused the update, if any
+func UpdateFrom(u bot.Update) *bot.User {
+	switch {
+	case u.Message != nil:
+		return u.Message.From
+	case u.EditedMessage != nil:
+		return u.EditedMessage.From
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.From
+	case u.InlineQuery != nil:
+		return u.InlineQuery.From
+	case u.PollAnswer != nil:
+		return &u.PollAnswer.User
+	case u.ChatMember != nil:
+		return &u.ChatMember.From
+	case u.MyChatMember != nil:
+		return &u.MyChatMember.From
+	}
+	return nil
+}
+
+// max length of a callback query alert
+const alertMaxLength = 200
+
+// ReplyTo sends the reply where the update came from. Messages get a reply
+// message, callback queries an alert, and inline queries a single result with
+// the text. Poll answers are replied in private.
+func ReplyTo(s bot.Service, u bot.Update, reply Reply) error {
+	switch {
+	case u.Message != nil || u.EditedMessage != nil:
+		msg := u.Message
+		if msg == nil {
+			msg = u.EditedMessage
+		}
+		_, err := s.SendMessage(bot.SendMessageParams{
+			ChatID:                   msg.Chat.ID,
+			ReplyToMessageID:         msg.MessageID,
+			AllowSendingWithoutReply: true,
+			Text:                     reply.Text,
+			ParseMode:                reply.ParseMode,
+		})
+		return err
+
+	case u.CallbackQuery != nil:
+		text := []rune(reply.Text)
+		if len(text) > alertMaxLength {
+			text = append(text[:alertMaxLength-3], []rune("...")...)
+		}
+		return s.AnswerCallbackQuery(bot.AnswerCallbackQueryParams{
+			CallbackQueryID: u.CallbackQuery.ID,
+			Text:            string(text),
+			ShowAlert:       true,
+		})
+
+	case u.InlineQuery != nil:
+		return s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
+			InlineQueryID: u.InlineQuery.ID,
+			Results: []bot.InlineQueryResult{
+				{
+					Type:  "article",
+					ID:    "reply",
+					Title: reply.Text,
+					InputMessageContent: &bot.InputMessageContent{
+						MessageText: reply.Text,
+					},
+				},
+			},
+			// errors shouldn't stay cached
+			CacheTime:  1,
+			IsPersonal: true,
+		})
+	}
+
+	var chatID int64
+	if chat := UpdateChat(u); chat != nil {
+		chatID = chat.ID
+	} else if from := UpdateFrom(u); from != nil {
+		chatID = from.ID
+	} else {
+		return errors.New("bothandler: update has nowhere to reply to")
+	}
+
+	_, err := s.SendMessage(bot.SendMessageParams{
+		ChatID:    chatID,
+		Text:      reply.Text,
+		ParseMode: reply.ParseMode,
+	})
+	return err
+}
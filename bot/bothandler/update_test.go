@@ -0,0 +1,163 @@
+package bothandler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestReplyTo(t *testing.T) {
+	chat := &bot.Chat{ID: 10}
+	user := &bot.User{ID: 20}
+	reply := Reply{Text: "erro"}
+
+	t.Run("message", func(t *testing.T) {
+		s := &fakeService{}
+		err := ReplyTo(s, bot.Update{Message: &bot.Message{MessageID: 5, Chat: chat, From: user}}, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.messages) != 1 || s.messages[0].ChatID != 10 || s.messages[0].ReplyToMessageID != 5 {
+			t.Fatalf("messages - want: reply to 5 in chat 10, got: %+v", s.messages)
+		}
+	})
+
+	t.Run("callback query", func(t *testing.T) {
+		s := &fakeService{}
+		long := Reply{Text: strings.Repeat("á", 300)}
+		err := ReplyTo(s, bot.Update{CallbackQuery: &bot.CallbackQuery{ID: "cq", From: user}}, long)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.messages) != 0 {
+			t.Fatalf("messages - want: none, got: %+v", s.messages)
+		}
+		if len(s.callbackAnswers) != 1 {
+			t.Fatalf("callback answers - want: 1, got: %d", len(s.callbackAnswers))
+		}
+		answer := s.callbackAnswers[0]
+		if answer.CallbackQueryID != "cq" || !answer.ShowAlert {
+			t.Fatalf("callback answer - want: alert to cq, got: %+v", answer)
+		}
+		if n := len([]rune(answer.Text)); n != alertMaxLength {
+			t.Fatalf("alert length - want: %d, got: %d", alertMaxLength, n)
+		}
+	})
+
+	t.Run("inline query", func(t *testing.T) {
+		s := &fakeService{}
+		err := ReplyTo(s, bot.Update{InlineQuery: &bot.InlineQuery{ID: "iq", From: user}}, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.inlineAnswers) != 1 {
+			t.Fatalf("inline answers - want: 1, got: %d", len(s.inlineAnswers))
+		}
+		answer := s.inlineAnswers[0]
+		if answer.InlineQueryID != "iq" || len(answer.Results) != 1 || answer.Results[0].Title != "erro" {
+			t.Fatalf("inline answer - want: one result titled erro, got: %+v", answer)
+		}
+	})
+
+	t.Run("poll answer", func(t *testing.T) {
+		s := &fakeService{}
+		err := ReplyTo(s, bot.Update{PollAnswer: &bot.PollAnswer{User: *user}}, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.messages) != 1 || s.messages[0].ChatID != 20 {
+			t.Fatalf("messages - want: one to user 20, got: %+v", s.messages)
+		}
+	})
+
+	t.Run("chat member", func(t *testing.T) {
+		s := &fakeService{}
+		err := ReplyTo(s, bot.Update{MyChatMember: &bot.ChatMemberUpdated{Chat: *chat, From: *user}}, reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.messages) != 1 || s.messages[0].ChatID != 10 {
+			t.Fatalf("messages - want: one to chat 10, got: %+v", s.messages)
+		}
+	})
+
+	t.Run("nowhere", func(t *testing.T) {
+		err := ReplyTo(&fakeService{}, bot.Update{}, reply)
+		if err == nil {
+			t.Fatal("want error, got nil")
+		}
+	})
+}
+
+func TestTypedHandlers(t *testing.T) {
+	source := make(chan bot.Update)
+	s := &fakeService{}
+	uh := NewUpdateHandler(s, source)
+
+	got := []string{}
+	uh.HandleCallback(CallbackDataPrefix("a:"), func(s bot.Service, cq *bot.CallbackQuery) error {
+		got = append(got, "callback a "+cq.Data)
+		return nil
+	})
+	uh.HandleCallback(nil, func(s bot.Service, cq *bot.CallbackQuery) error {
+		got = append(got, "callback "+cq.Data)
+		return Reply{Text: "não"}
+	})
+	uh.HandleInline(nil, func(s bot.Service, q *bot.InlineQuery) error {
+		got = append(got, "inline "+q.Query)
+		return nil
+	})
+	uh.HandlePollAnswer(nil, func(s bot.Service, answer *bot.PollAnswer) error {
+		got = append(got, "poll answer "+answer.PollID)
+		return nil
+	})
+	uh.HandleChatMember(nil, func(s bot.Service, m *bot.ChatMemberUpdated) error {
+		got = append(got, "chat member "+m.NewChatMember.Status)
+		return nil
+	})
+	uh.HandleMessage(nil, func(s bot.Service, msg *bot.Message) error {
+		got = append(got, "message "+msg.Text)
+		return nil
+	})
+
+	// a single chat key keeps the handlers in order
+	uh.Key = func(u bot.Update) string {
+		return "all"
+	}
+
+	done := make(chan struct{})
+	go func() {
+		uh.Start()
+		close(done)
+	}()
+
+	user := &bot.User{ID: 1}
+	source <- bot.Update{CallbackQuery: &bot.CallbackQuery{ID: "1", From: user, Data: "a:1"}}
+	source <- bot.Update{CallbackQuery: &bot.CallbackQuery{ID: "2", From: user, Data: "b"}}
+	source <- bot.Update{InlineQuery: &bot.InlineQuery{ID: "3", From: user, Query: "q"}}
+	source <- bot.Update{PollAnswer: &bot.PollAnswer{PollID: "p", User: *user}}
+	source <- bot.Update{MyChatMember: &bot.ChatMemberUpdated{NewChatMember: bot.ChatMember{Status: "left"}}}
+	source <- bot.Update{Message: &bot.Message{Chat: &bot.Chat{ID: 1}, From: user, Text: "oi"}}
+	close(source)
+	<-done
+
+	want := []string{
+		"callback a a:1",
+		"callback b",
+		"inline q",
+		"poll answer p",
+		"chat member left",
+		"message oi",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("handled - want: %q, got: %q", want, got)
+	}
+
+	if len(s.callbackAnswers) != 1 || s.callbackAnswers[0].CallbackQueryID != "2" {
+		t.Fatalf("callback answers - want: the reply to 2, got: %+v", s.callbackAnswers)
+	}
+	if len(s.messages) != 0 {
+		t.Fatalf("messages - want: none, got: %+v", s.messages)
+	}
+}
@@ -0,0 +1,150 @@
+package botrecord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+var ErrOffline = errors.New("botrecord: the fake service is offline")
+
+// FakeService is a bot.Service that prints every call instead of calling
+// telegram, one line per call with the method and its params as JSON.
+// Files can't be downloaded.
+type FakeService struct {
+	// MemberStatus is the status returned by GetChatMember
+	MemberStatus string
+
+	mut    *sync.Mutex
+	w      io.Writer
+	me     bot.User
+	lastID int
+}
+
+func NewFakeService(w io.Writer, me bot.User) *FakeService {
+	return &FakeService{
+		MemberStatus: "member",
+		mut:          new(sync.Mutex),
+		w:            w,
+		me:           me,
+		// far from the ids of the recorded messages
+		lastID: 1_000_000,
+	}
+}
+
+// call prints the call and returns the id of the next message sent by the bot
+func (s *FakeService) call(method string, params any) int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		b = []byte(err.Error())
+	}
+	fmt.Fprintf(s.w, "%s %s\n", method, b)
+
+	s.lastID++
+	return s.lastID
+}
+
+func (s *FakeService) sent(id int, chatID int64) *bot.Message {
+	return &bot.Message{
+		MessageID: id,
+		From:      &s.me,
+		Chat:      &bot.Chat{ID: chatID},
+	}
+}
+
+func (s *FakeService) Username() string {
+	return s.me.Username
+}
+
+func (s *FakeService) GetMe() (*bot.User, error) {
+	me := s.me
+	return &me, nil
+}
+
+func (s *FakeService) GetChatMember(params bot.GetChatMemberParams) (*bot.ChatMember, error) {
+	s.call("getChatMember", params)
+	return &bot.ChatMember{
+		Status: s.MemberStatus,
+		User:   &bot.User{ID: params.UserID},
+	}, nil
+}
+
+func (s *FakeService) GetUpdates(params bot.GetUpdatesParams) ([]bot.Update, error) {
+	return nil, ErrOffline
+}
+
+func (s *FakeService) GetUpdatesChannel() chan bot.Update {
+	ch := make(chan bot.Update)
+	close(ch)
+	return ch
+}
+
+func (s *FakeService) SendVoice(params bot.SendVoiceParams) (*bot.Message, error) {
+	id := s.call("sendVoice", params)
+	msg := s.sent(id, params.ChatID)
+	msg.Voice = &bot.Voice{FileID: params.Voice}
+	return msg, nil
+}
+
+func (s *FakeService) SendPoll(params bot.SendPollParams) (*bot.Message, error) {
+	id := s.call("sendPoll", params)
+	msg := s.sent(id, params.ChatID)
+	msg.Poll = &bot.Poll{ID: fmt.Sprint("poll", id)}
+	return msg, nil
+}
+
+func (s *FakeService) SendMessage(params bot.SendMessageParams) (*bot.Message, error) {
+	id := s.call("sendMessage", params)
+	msg := s.sent(id, params.ChatID)
+	msg.Text = params.Text
+	return msg, nil
+}
+
+func (s *FakeService) EditMessageText(params bot.EditMessageTextParams) (*bot.Message, error) {
+	s.call("editMessageText", params)
+	msg := s.sent(params.MessageID, params.ChatID)
+	msg.Text = params.Text
+	return msg, nil
+}
+
+func (s *FakeService) AnswerInlineQuery(params bot.AnswerInlineQueryParams) error {
+	s.call("answerInlineQuery", params)
+	return nil
+}
+
+func (s *FakeService) AnswerCallbackQuery(params bot.AnswerCallbackQueryParams) error {
+	s.call("answerCallbackQuery", params)
+	return nil
+}
+
+func (s *FakeService) SetMyCommands(params bot.SetMyCommandsParams) error {
+	s.call("setMyCommands", params)
+	return nil
+}
+
+func (s *FakeService) SendDocument(params bot.SendDocumentParams) error {
+	// the content is usually big and binary
+	s.call("sendDocument", struct {
+		ChatID   int64  `json:"chat_id"`
+		FileName string `json:"file_name"`
+		Size     int    `json:"size"`
+		Caption  string `json:"caption,omitempty"`
+	}{params.ChatID, params.FileName, len(params.Content), params.Caption})
+	return nil
+}
+
+func (s *FakeService) GetFile(params bot.GetFileParams) (*bot.File, error) {
+	s.call("getFile", params)
+	return nil, ErrOffline
+}
+
+func (s *FakeService) DownloadFile(filePath string) ([]byte, error) {
+	return nil, ErrOffline
+}
@@ -0,0 +1,149 @@
+// Package botrecord records the updates received by the bot to a JSONL file,
+// and replays them against a fake bot.Service.
+package botrecord
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+const redacted = "<redacted>"
+
+// bot tokens (123456:ABC...) and OpenAI keys (sk-...)
+var tokenRegexp = regexp.MustCompile(`\d{5,}:[A-Za-z0-9_-]{30,}|sk-[A-Za-z0-9_-]{20,}`)
+
+// Recorder appends updates to a JSONL file, one update per line
+type Recorder struct {
+	mut *sync.Mutex
+	w   io.WriteCloser
+	// keepTexts disables the redaction of texts
+	keepTexts bool
+}
+
+// NewRecorder appends the updates to the file at path. Texts are redacted
+// unless keepTexts is true. Tokens are always redacted.
+func NewRecorder(path string, keepTexts bool) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		mut:       new(sync.Mutex),
+		w:         f,
+		keepTexts: keepTexts,
+	}, nil
+}
+
+func (r *Recorder) Record(u bot.Update) error {
+	if !r.keepTexts {
+		u = RedactTexts(u)
+	}
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	b = tokenRegexp.ReplaceAll(b, []byte(redacted))
+	b = append(b, '\n')
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	_, err = r.w.Write(b)
+	return err
+}
+
+// Tee records the updates of source as they pass through the returned channel
+func (r *Recorder) Tee(source <-chan bot.Update) <-chan bot.Update {
+	out := make(chan bot.Update)
+	go func() {
+		defer close(out)
+		for u := range source {
+			err := r.Record(u)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "botrecord:", err)
+			}
+			out <- u
+		}
+	}()
+	return out
+}
+
+func (r *Recorder) Close() error {
+	return r.w.Close()
+}
+
+// RedactTexts returns a copy of the update without the texts written by users.
+// Commands keep their name, so the recording still reaches the same handlers.
+func RedactTexts(u bot.Update) bot.Update {
+	u.Message = redactMessage(u.Message)
+	u.EditedMessage = redactMessage(u.EditedMessage)
+	if u.CallbackQuery != nil {
+		cq := *u.CallbackQuery
+		cq.Message = redactMessage(cq.Message)
+		u.CallbackQuery = &cq
+	}
+	if u.InlineQuery != nil {
+		q := *u.InlineQuery
+		q.Query = redactText(q.Query)
+		u.InlineQuery = &q
+	}
+	return u
+}
+
+func redactMessage(msg *bot.Message) *bot.Message {
+	if msg == nil {
+		return nil
+	}
+	m := *msg
+	m.Text = redactText(m.Text)
+	m.Caption = redactText(m.Caption)
+	// offsets would point to the redacted text
+	m.Entities = nil
+	m.CaptionEntities = nil
+	m.ReplyToMessage = redactMessage(m.ReplyToMessage)
+	return &m
+}
+
+func redactText(text string) string {
+	if text == "" {
+		return ""
+	}
+	if strings.HasPrefix(text, "/") {
+		cmd, _, ok := strings.Cut(text, " ")
+		if ok {
+			return cmd + " " + redacted
+		}
+		return cmd
+	}
+	return redacted
+}
+
+// ReadUpdates reads updates recorded by a Recorder. Blank lines are ignored.
+func ReadUpdates(r io.Reader) ([]bot.Update, error) {
+	updates := []bot.Update{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Bytes()
+		if strings.TrimSpace(string(b)) == "" {
+			continue
+		}
+		var u bot.Update
+		err := json.Unmarshal(b, &u)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		updates = append(updates, u)
+	}
+
+	return updates, scanner.Err()
+}
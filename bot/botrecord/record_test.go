@@ -0,0 +1,107 @@
+package botrecord
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.jsonl")
+
+	updates := []bot.Update{
+		{
+			UpdateID: 1,
+			Message: &bot.Message{
+				Text: "meu token é 123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsawq",
+				Chat: &bot.Chat{ID: 1},
+				ReplyToMessage: &bot.Message{
+					Text: "segredo",
+				},
+			},
+		},
+		{
+			UpdateID: 2,
+			Message: &bot.Message{
+				Text:     "/ask qual a chave sk-abcdefghijklmnopqrstuvwxyz?",
+				Entities: []bot.MessageEntity{{Type: "bot_command", Length: 4}},
+				Chat:     &bot.Chat{ID: 1},
+			},
+		},
+		{
+			UpdateID:    3,
+			InlineQuery: &bot.InlineQuery{ID: "q", Query: "bom dia"},
+		},
+	}
+
+	for _, keepTexts := range []bool{false, true} {
+		os.Remove(path)
+
+		rec, err := NewRecorder(path, keepTexts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range updates {
+			err = rec.Record(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec.Close()
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsawq", "sk-abcdefghijklmnopqrstuvwxyz"} {
+			if strings.Contains(string(b), secret) {
+				t.Fatalf("keepTexts %v - token %q was recorded", keepTexts, secret)
+			}
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadUpdates(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(updates) {
+			t.Fatalf("updates - want: %d, got: %d", len(updates), len(got))
+		}
+
+		if keepTexts {
+			if got[2].InlineQuery.Query != "bom dia" {
+				t.Fatalf("query - want: %q, got: %q", "bom dia", got[2].InlineQuery.Query)
+			}
+			continue
+		}
+
+		if got[0].Message.Text != redacted || got[0].Message.ReplyToMessage.Text != redacted {
+			t.Fatalf("texts - want: redacted, got: %q and %q", got[0].Message.Text, got[0].Message.ReplyToMessage.Text)
+		}
+		if got[1].Message.Text != "/ask "+redacted {
+			t.Fatalf("command - want: %q, got: %q", "/ask "+redacted, got[1].Message.Text)
+		}
+		if got[2].InlineQuery.Query != redacted {
+			t.Fatalf("query - want: redacted, got: %q", got[2].InlineQuery.Query)
+		}
+	}
+
+	// the recorded update is not changed
+	if updates[0].Message.Text == redacted {
+		t.Fatal("RedactTexts changed the original update")
+	}
+}
+
+func TestReadUpdatesInvalidLine(t *testing.T) {
+	_, err := ReadUpdates(strings.NewReader("{\"update_id\":1}\n\nnope\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("error - want: line 3, got: %v", err)
+	}
+}
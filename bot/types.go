@@ -3,20 +3,55 @@ package bot
 import "encoding/json"
 
 type Message struct {
-	MessageID         int      `json:"message_id"`
-	Date              int64    `json:"date"`
-	Text              string   `json:"text,omitempty"`
-	ForwardSenderName string   `json:"forward_sender_name,omitempty"`
-	From              *User    `json:"from,omitempty"`
-	FowardFrom        *User    `json:"forward_from,omitempty"`
-	Chat              *Chat    `json:"chat,omitempty"`
-	ReplyToMessage    *Message `json:"reply_to_message,omitempty"`
-	Poll              *Poll    `json:"poll,omitempty"`
-	Voice             *Voice   `json:"voice,omitempty"`
+	MessageID         int             `json:"message_id"`
+	Date              int64           `json:"date"`
+	EditDate          int64           `json:"edit_date,omitempty"`
+	Text              string          `json:"text,omitempty"`
+	Entities          []MessageEntity `json:"entities,omitempty"`
+	Caption           string          `json:"caption,omitempty"`
+	CaptionEntities   []MessageEntity `json:"caption_entities,omitempty"`
+	ForwardSenderName string          `json:"forward_sender_name,omitempty"`
+	From              *User           `json:"from,omitempty"`
+	FowardFrom        *User           `json:"forward_from,omitempty"`
+	ForwardFromChat   *Chat           `json:"forward_from_chat,omitempty"`
+	Chat              *Chat           `json:"chat,omitempty"`
+	ReplyToMessage    *Message        `json:"reply_to_message,omitempty"`
+	Poll              *Poll           `json:"poll,omitempty"`
+	Voice             *Voice          `json:"voice,omitempty"`
+	Photo             []PhotoSize     `json:"photo,omitempty"`
+	Sticker           *Sticker        `json:"sticker,omitempty"`
+	Document          *Document       `json:"document,omitempty"`
+}
+
+type MessageEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url,omitempty"`
+	User   *User  `json:"user,omitempty"`
 }
 
 type Voice struct {
+	FileID   string `json:"file_id"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+type PhotoSize struct {
+	FileID   string `json:"file_id"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FileSize int    `json:"file_size,omitempty"`
+}
+
+type Sticker struct {
 	FileID string `json:"file_id"`
+	Emoji  string `json:"emoji,omitempty"`
+}
+
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 type Poll struct {
@@ -76,6 +111,15 @@ type User struct {
 
 type ChatMember struct {
 	Status string `json:"status,omitempty"`
+	User   *User  `json:"user,omitempty"`
+}
+
+type ChatMemberUpdated struct {
+	Chat          Chat       `json:"chat"`
+	From          User       `json:"from"`
+	Date          int64      `json:"date"`
+	OldChatMember ChatMember `json:"old_chat_member"`
+	NewChatMember ChatMember `json:"new_chat_member"`
 }
 
 type Chat struct {
@@ -95,9 +139,14 @@ func (c Chat) Name() string {
 type Update struct {
 	UpdateID      int            `json:"update_id"`
 	Message       *Message       `json:"message,omitempty"`
+	EditedMessage *Message       `json:"edited_message,omitempty"`
 	PollAnswer    *PollAnswer    `json:"poll_answer,omitempty"`
 	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
 	InlineQuery   *InlineQuery   `json:"inline_query,omitempty"`
+	// MyChatMember is a change of the bot's own membership
+	MyChatMember *ChatMemberUpdated `json:"my_chat_member,omitempty"`
+	// ChatMember is a change of another member. Telegram only sends it to admin bots.
+	ChatMember *ChatMemberUpdated `json:"chat_member,omitempty"`
 }
 
 func (u Update) String() string {
@@ -122,26 +171,68 @@ type CallbackQuery struct {
 }
 
 type InlineQuery struct {
-	ID    string `json:"id"`
-	From  *User  `json:"from"`
-	Query string `json:"query"`
+	ID     string `json:"id"`
+	From   *User  `json:"from"`
+	Query  string `json:"query"`
+	Offset string `json:"offset"`
 }
 
 type AnswerInlineQueryParams struct {
 	InlineQueryID string              `json:"inline_query_id"`
 	Results       []InlineQueryResult `json:"results"`
+	CacheTime     int                 `json:"cache_time,omitempty"`
+	// IsPersonal makes telegram cache the results only for the user who sent the query
+	IsPersonal bool   `json:"is_personal,omitempty"`
+	NextOffset string `json:"next_offset,omitempty"`
+	// SwitchPMText shows a button above the results that opens a private
+	// chat with the bot, sending /start SwitchPMParameter
+	SwitchPMText      string `json:"switch_pm_text,omitempty"`
+	SwitchPMParameter string `json:"switch_pm_parameter,omitempty"`
+}
+
+type AnswerCallbackQueryParams struct {
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+}
+
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+const (
+	BotCommandScopeAllPrivateChats       = "all_private_chats"
+	BotCommandScopeAllGroupChats         = "all_group_chats"
+	BotCommandScopeAllChatAdministrators = "all_chat_administrators"
+)
+
+type BotCommandScope struct {
+	Type string `json:"type"`
+}
+
+type SetMyCommandsParams struct {
+	Commands []BotCommand    `json:"commands"`
+	Scope    BotCommandScope `json:"scope"`
 }
 
 type SendDocumentParams struct {
 	ChatID   int64
 	FileName string
+	// Content is sent instead of the contents of FileName, if set
+	Content []byte
+	Caption string
 }
 
+// InlineQueryResult is one of the result types. "article" results have
+// InputMessageContent and "voice" results have VoiceFileID.
 type InlineQueryResult struct {
-	Type                string              `json:"type"`
-	ID                  string              `json:"id"`
-	Title               string              `json:"title"`
-	InputMessageContent InputMessageContent `json:"input_message_content"`
+	Type                string               `json:"type"`
+	ID                  string               `json:"id"`
+	Title               string               `json:"title"`
+	InputMessageContent *InputMessageContent `json:"input_message_content,omitempty"`
+	VoiceFileID         string               `json:"voice_file_id,omitempty"`
+	Caption             string               `json:"caption,omitempty"`
 }
 
 type InputMessageContent struct {
@@ -149,6 +240,17 @@ type InputMessageContent struct {
 	ParseMode   string `json:"parse_mode,omitempty"`
 }
 
+type GetFileParams struct {
+	FileID string `json:"file_id"`
+}
+
+type File struct {
+	FileID   string `json:"file_id"`
+	FileSize int    `json:"file_size,omitempty"`
+	// FilePath is used to download the file with DownloadFile
+	FilePath string `json:"file_path,omitempty"`
+}
+
 type GetChatMemberParams struct {
 	ChatID int64 `json:"chat_id"`
 	UserID int64 `json:"user_id"`
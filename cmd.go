@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/backup"
+	"github.com/igoracmelo/euperturbot/config"
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo"
+)
+
+type command struct {
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+// commands of the CLI. serve runs when no command is given.
+var commands map[string]command
+
+// commands is set in init because the commands look up their own usage in it
+func init() {
+	commands = map[string]command{
+		"serve": {
+			usage:       "serve [flags]",
+			description: "runs the bot",
+			run:         serve,
+		},
+		"migrate": {
+			usage:       "migrate [flags] up|status",
+			description: "migrates the database or shows the migrations applied to it",
+			run:         migrate,
+		},
+		"backup": {
+			usage:       "backup [flags] <file>",
+			description: "copies the database to the file, even while the bot runs",
+			run:         backupCmd,
+		},
+		"restore": {
+			usage:       "restore [flags] <file>",
+			description: "replaces the database with the backup, compressed or not. the bot must be stopped",
+			run:         restore,
+		},
+		"export": {
+			usage:       "export [flags] <chat id>",
+			description: "prints the topics of the chat and their subscribers as JSON",
+			run:         export,
+		},
+		"config": {
+			usage:       "config [flags]",
+			description: "prints the config, without the secrets",
+			run:         printConfig,
+		},
+		"replay": {
+			usage:       "replay [flags] <updates.jsonl>",
+			description: "handles recorded updates offline and prints the calls to telegram",
+			run:         replayCmd,
+		},
+	}
+}
+
+func usage() {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: euperturbot <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-32s %s\n", commands[name].usage, commands[name].description)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "run euperturbot <command> -h for the flags")
+}
+
+// options are the flags all commands take. They override the config.
+type options struct {
+	fs      *flag.FlagSet
+	configs []string
+	conf    config.Config
+}
+
+func newFlagSet(name string, usage string) (*flag.FlagSet, *options) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Func("config", "config file. can be repeated, later files override earlier ones (default config.json, if it exists)", func(path string) error {
+		opts.configs = append(opts.configs, path)
+		return nil
+	})
+	fs.StringVar(&opts.conf.DBPath, "db", "", "database file")
+	fs.StringVar(&opts.conf.Migrations, "migrations", "", "migrations directory (default: the ones embedded in the binary)")
+	fs.StringVar(&opts.conf.LogLevel, "log-level", "", "info or debug")
+	fs.IntVar(&opts.conf.Workers, "workers", 0, "how many updates are handled at the same time")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: euperturbot %s\n", usage)
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\nthe config can also be set with %s* environment variables\n", config.EnvPrefix)
+	}
+	opts.fs = fs
+
+	return fs, opts
+}
+
+// loadConfig loads the config files, the environment and the flags, in this
+// order, and validates the result
+func (o *options) loadConfig() (config.Config, error) {
+	paths := o.configs
+	if len(paths) == 0 {
+		if _, err := os.Stat("config.json"); err == nil {
+			paths = []string{"config.json"}
+		}
+	}
+
+	conf, err := config.Load(paths, os.LookupEnv)
+	if err != nil {
+		return conf, err
+	}
+
+	o.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			conf.DBPath = o.conf.DBPath
+		case "migrations":
+			conf.Migrations = o.conf.Migrations
+		case "log-level":
+			conf.LogLevel = o.conf.LogLevel
+		case "workers":
+			conf.Workers = o.conf.Workers
+		}
+	})
+
+	err = conf.Validate()
+	if err != nil {
+		return conf, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return conf, nil
+}
+
+// errUsage is returned when the command was called wrong. The usage is
+// already printed.
+var errUsage = errors.New("wrong usage")
+
+// parseArgs parses the flags and checks the number of positional arguments.
+// flags add the flags of the command itself.
+func parseArgs(name string, args []string, n int, flags ...func(*flag.FlagSet)) ([]string, *options, error) {
+	cmd := commands[name]
+	fs, opts := newFlagSet(name, cmd.usage)
+	for _, f := range flags {
+		f(fs)
+	}
+
+	// the flag package prints the error and the usage
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, errUsage
+	}
+
+	if fs.NArg() != n {
+		fs.Usage()
+		return nil, nil, errUsage
+	}
+
+	return fs.Args(), opts, nil
+}
+
+func migrate(args []string) error {
+	dryRun := false
+	args, opts, err := parseArgs("migrate", args, 1, func(fs *flag.FlagSet) {
+		fs.BoolVar(&dryRun, "dry-run", false, "up only lists the pending migrations")
+	})
+	if err != nil {
+		return err
+	}
+
+	conf, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		if dryRun {
+			return printMigrations(conf, true)
+		}
+		db, err := sqliterepo.Open(context.TODO(), conf.DBPath, conf.Migrations)
+		if err != nil {
+			return err
+		}
+		return db.Close()
+
+	case "status":
+		return printMigrations(conf, false)
+	}
+
+	return fmt.Errorf("unknown migrate action %q. use up or status", args[0])
+}
+
+// printMigrations prints the migrations and whether they were applied.
+// pendingOnly leaves out the applied ones that weren't edited.
+func printMigrations(conf config.Config, pendingOnly bool) error {
+	migrations, err := sqliterepo.Status(context.TODO(), conf.DBPath, conf.Migrations)
+	if err != nil {
+		return err
+	}
+
+	pending, edited := 0, 0
+	for _, m := range migrations {
+		state := "applied"
+		switch {
+		case m.Edited:
+			state = "EDITED after applied"
+			edited++
+		case !m.Applied:
+			state = "pending"
+			pending++
+		case pendingOnly:
+			continue
+		}
+		fmt.Printf("%-8s %s  %s\n", m.Name, m.Checksum[:12], state)
+	}
+
+	fmt.Printf("%s: %d migrations, %d pending", conf.DBPath, len(migrations), pending)
+	if edited > 0 {
+		fmt.Printf(", %d edited", edited)
+	}
+	fmt.Println()
+
+	if edited > 0 {
+		return errors.New("edited migrations can't be applied. write a new migration instead")
+	}
+	return nil
+}
+
+func backupCmd(args []string) error {
+	args, opts, err := parseArgs("backup", args, 1)
+	if err != nil {
+		return err
+	}
+
+	conf, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	return sqliterepo.Backup(context.TODO(), conf.DBPath, args[0])
+}
+
+func restore(args []string) error {
+	args, opts, err := parseArgs("restore", args, 1)
+	if err != nil {
+		return err
+	}
+
+	conf, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	src := args[0]
+	compressed, err := backup.IsCompressed(src)
+	if err != nil {
+		return err
+	}
+	if compressed {
+		extracted := conf.DBPath + ".extracted"
+		err = backup.Extract(src, extracted, conf.BackupPassphrase)
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", src, err)
+		}
+		defer os.Remove(extracted)
+		src = extracted
+	}
+
+	// keeps the current database, in case the wrong backup was chosen
+	_, err = os.Stat(conf.DBPath)
+	if err == nil {
+		previous := fmt.Sprintf("%s.%s.bak", conf.DBPath, time.Now().Format("20060102150405"))
+		err = sqliterepo.Backup(context.TODO(), conf.DBPath, previous)
+		if err != nil {
+			return fmt.Errorf("backup current database: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "current database saved to", previous)
+	}
+
+	// the integrity is checked before replacing the database
+	err = sqliterepo.Restore(context.TODO(), src, conf.DBPath)
+	if err != nil {
+		return err
+	}
+
+	// the backup may be from an older version
+	db, err := sqliterepo.Open(context.TODO(), conf.DBPath, conf.Migrations)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+type exportedTopic struct {
+	Topic       string         `json:"topic"`
+	Subscribers []exportedUser `json:"subscribers"`
+}
+
+type exportedUser struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+func export(args []string) error {
+	args, opts, err := parseArgs("export", args, 1)
+	if err != nil {
+		return err
+	}
+
+	chatID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat id %q", args[0])
+	}
+
+	conf, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// exporting must not change the database, so it isn't migrated
+	db, err := sqliterepo.OpenCurrent(context.TODO(), conf.DBPath, conf.Migrations)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	topics, err := db.FindChatTopics(chatID)
+	if err != nil {
+		return err
+	}
+
+	exported := struct {
+		ChatID int64           `json:"chat_id"`
+		Topics []exportedTopic `json:"topics"`
+	}{
+		ChatID: chatID,
+		Topics: []exportedTopic{},
+	}
+
+	for _, topic := range topics {
+		users, err := db.FindUsersByTopic(chatID, topic.Topic)
+		if err != nil {
+			return err
+		}
+
+		t := exportedTopic{
+			Topic:       topic.Topic,
+			Subscribers: []exportedUser{},
+		}
+		for _, u := range users {
+			t.Subscribers = append(t.Subscribers, exportedUser{
+				ID:        u.ID,
+				FirstName: u.FirstName,
+				Username:  u.Username,
+			})
+		}
+		exported.Topics = append(exported.Topics, t)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(exported)
+}
+
+func printConfig(args []string) error {
+	_, opts, err := parseArgs("config", args, 0)
+	if err != nil {
+		return err
+	}
+
+	conf, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(conf.Redacted())
+}
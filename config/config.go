@@ -1,22 +1,315 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// EnvPrefix prefixes the environment variables of the config, e.g. EUPERTURBOT_BOT_TOKEN.
+// Each variable can also be read from a file with the _FILE suffix, e.g.
+// EUPERTURBOT_BOT_TOKEN_FILE=/run/secrets/token.
+const EnvPrefix = "EUPERTURBOT_"
+
+const redacted = "<redacted>"
+
+// Config is layered: Default, then each file in order, then the environment.
+// The CLI flags go on top.
 type Config struct {
-	GodID     int64
-	GPTUserID int64 `json:"gptUserID"`
-	BotToken  string
-	OpenAIKey string
+	BotToken string `json:"botToken"`
+	// GodIDs are the users that own the bot
+	GodIDs    []int64 `json:"godIDs"`
+	GPTUserID int64   `json:"gptUserID"`
+
+	OpenAIKey     string `json:"openAIKey"`
+	OpenAIBaseURL string `json:"openAIBaseURL"`
+	// OpenAIModel is the model of the completions
+	OpenAIModel string `json:"openAIModel"`
+
+	// DBPath is the sqlite database file
+	DBPath string `json:"dbPath"`
+	// Migrations is the directory of the migrations. Empty uses the ones
+	// embedded in the binary.
+	Migrations string `json:"migrations"`
+
+	// LogLevel is info or debug. debug also logs every update.
+	LogLevel string `json:"logLevel"`
+	// Workers is how many updates are handled at the same time
+	Workers int `json:"workers"`
+
+	// RecordUpdates is the JSONL file where the received updates are recorded,
+	// with tokens and texts redacted. Empty disables the recording.
+	RecordUpdates string `json:"recordUpdates"`
+	// RecordTexts keeps the texts of the recorded updates
+	RecordTexts bool `json:"recordTexts"`
+
+	// BackupDir keeps the backups of the database
+	BackupDir string `json:"backupDir"`
+	// BackupInterval is how often a backup is made and sent to the gods.
+	// Zero disables the scheduled backups.
+	BackupInterval Duration `json:"backupInterval"`
+	// BackupKeep is how many backups are kept in BackupDir
+	BackupKeep int `json:"backupKeep"`
+	// BackupPassphrase encrypts the backups, if set
+	BackupPassphrase string `json:"backupPassphrase"`
+
+	// GodID is the old way of setting a single god. It is moved to GodIDs.
+	GodID int64 `json:"godID,omitempty"`
 }
 
-func Load() (c Config, err error) {
-	b, err := os.ReadFile("config.json")
+func Default() Config {
+	return Config{
+		OpenAIBaseURL: "https://api.openai.com/v1",
+		OpenAIModel:   "gpt-3.5-turbo",
+		DBPath:        "euperturbot.db",
+		LogLevel:      "info",
+		Workers:       10,
+		BackupDir:     "backups",
+		BackupKeep:    7,
+	}
+}
+
+// Duration is a time.Duration written as a string, e.g. "24h"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
 	if err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+// Load loads the files in order over the defaults, and then the environment
+// variables found with lookup, usually os.LookupEnv
+func Load(paths []string, lookup func(string) (string, bool)) (Config, error) {
+	c := Default()
+	for _, path := range paths {
+		err := c.LoadFile(path)
+		if err != nil {
+			return c, err
+		}
+	}
+	err := c.LoadEnv(lookup)
+	return c, err
+}
+
+// LoadFile sets the fields present in the JSON file. Unknown fields are an
+// error, since they are usually typos.
+func (c *Config) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(c)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	c.moveGodID()
+	return nil
+}
+
+func (c *Config) moveGodID() {
+	if c.GodID == 0 {
 		return
 	}
-	err = json.Unmarshal(b, &c)
-	return
+	if !c.IsGod(c.GodID) {
+		c.GodIDs = append(c.GodIDs, c.GodID)
+	}
+	c.GodID = 0
+}
+
+// env maps the environment variables, without EnvPrefix, to the fields
+func (c *Config) env() map[string]any {
+	return map[string]any{
+		"BOT_TOKEN":       &c.BotToken,
+		"GOD_IDS":         &c.GodIDs,
+		"GPT_USER_ID":     &c.GPTUserID,
+		"OPENAI_KEY":      &c.OpenAIKey,
+		"OPENAI_BASE_URL": &c.OpenAIBaseURL,
+		"OPENAI_MODEL":    &c.OpenAIModel,
+		"DB_PATH":         &c.DBPath,
+		"MIGRATIONS":      &c.Migrations,
+		"LOG_LEVEL":       &c.LogLevel,
+		"WORKERS":         &c.Workers,
+		"RECORD_UPDATES":  &c.RecordUpdates,
+		"RECORD_TEXTS":    &c.RecordTexts,
+
+		"BACKUP_DIR":        &c.BackupDir,
+		"BACKUP_INTERVAL":   &c.BackupInterval,
+		"BACKUP_KEEP":       &c.BackupKeep,
+		"BACKUP_PASSPHRASE": &c.BackupPassphrase,
+	}
+}
+
+// LoadEnv sets the fields whose environment variables are set. A variable
+// with the _FILE suffix is read from the file it names.
+func (c *Config) LoadEnv(lookup func(string) (string, bool)) error {
+	vars := c.env()
+
+	names := []string{}
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := []error{}
+	for _, name := range names {
+		key := EnvPrefix + name
+		value, ok := lookup(key)
+		if !ok {
+			path, ok := lookup(key + "_FILE")
+			if !ok {
+				continue
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s_FILE: %w", key, err))
+				continue
+			}
+			key += "_FILE"
+			value = strings.TrimSpace(string(b))
+		}
+
+		err := set(vars[name], value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func set(field any, value string) error {
+	var err error
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *int:
+		*f, err = strconv.Atoi(value)
+	case *int64:
+		*f, err = strconv.ParseInt(value, 10, 64)
+	case *bool:
+		*f, err = strconv.ParseBool(value)
+	case *Duration:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		*f = Duration(d)
+	case *[]int64:
+		*f = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return err
+			}
+			*f = append(*f, id)
+		}
+	default:
+		panic(fmt.Sprintf("config: unsupported field type %T", field))
+	}
+	return err
+}
+
+var botTokenRegexp = regexp.MustCompile(`^\d+:[A-Za-z0-9_-]+$`)
+
+// Validate returns all the problems of the config, joined
+func (c Config) Validate() error {
+	errs := []error{}
+	invalid := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	// the token is not shown, since it is a secret
+	if c.BotToken != "" && !botTokenRegexp.MatchString(c.BotToken) {
+		invalid("botToken", "should look like 123456:ABC-DEF")
+	}
+	for _, id := range c.GodIDs {
+		if id <= 0 {
+			invalid("godIDs", "%d is not a user id", id)
+		}
+	}
+	if err := validateURL(c.OpenAIBaseURL); err != nil {
+		invalid("openAIBaseURL", "%s", err)
+	}
+	if c.OpenAIModel == "" {
+		invalid("openAIModel", "is empty")
+	}
+	if c.DBPath == "" {
+		invalid("dbPath", "is empty")
+	}
+	if c.LogLevel != "info" && c.LogLevel != "debug" {
+		invalid("logLevel", "%q should be info or debug", c.LogLevel)
+	}
+	if c.Workers < 1 {
+		invalid("workers", "should be at least 1, got %d", c.Workers)
+	}
+	if c.BackupDir == "" {
+		invalid("backupDir", "is empty")
+	}
+	if c.BackupInterval < 0 {
+		invalid("backupInterval", "should not be negative")
+	}
+	if c.BackupInterval > 0 && c.BackupInterval < Duration(time.Minute) {
+		invalid("backupInterval", "should be at least 1m, got %s", time.Duration(c.BackupInterval))
+	}
+	if c.BackupKeep < 1 {
+		invalid("backupKeep", "should be at least 1, got %d", c.BackupKeep)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", s)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q should be http or https", s)
+	}
+	return nil
+}
+
+// Redacted returns a copy without the secrets, to be shown
+func (c Config) Redacted() Config {
+	for _, secret := range []*string{&c.BotToken, &c.OpenAIKey, &c.BackupPassphrase} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	return c
+}
+
+func (c Config) IsGod(userID int64) bool {
+	for _, id := range c.GodIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
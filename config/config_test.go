@@ -0,0 +1,152 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	base := writeFile(t, "base.json", `{"botToken": "1:base", "godID": 7, "workers": 3, "dbPath": "base.db"}`)
+	local := writeFile(t, "local.json", `{"dbPath": "local.db", "logLevel": "debug", "backupInterval": "24h"}`)
+	secret := writeFile(t, "key", "sk-secret\n")
+
+	c, err := Load([]string{base, local}, env(map[string]string{
+		EnvPrefix + "WORKERS":         "5",
+		EnvPrefix + "GOD_IDS":         "1, 2",
+		EnvPrefix + "OPENAI_KEY_FILE": secret,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.BotToken != "1:base" {
+		t.Fatalf("botToken - want: %q, got: %q", "1:base", c.BotToken)
+	}
+	if c.DBPath != "local.db" {
+		t.Fatalf("dbPath - want: %q, got: %q", "local.db", c.DBPath)
+	}
+	if c.LogLevel != "debug" {
+		t.Fatalf("logLevel - want: %q, got: %q", "debug", c.LogLevel)
+	}
+	if c.Workers != 5 {
+		t.Fatalf("workers - want: %d, got: %d", 5, c.Workers)
+	}
+	if c.OpenAIKey != "sk-secret" {
+		t.Fatalf("openAIKey - want: %q, got: %q", "sk-secret", c.OpenAIKey)
+	}
+	// the environment replaces the gods of the files
+	if len(c.GodIDs) != 2 || !c.IsGod(1) || !c.IsGod(2) || c.IsGod(7) {
+		t.Fatalf("godIDs - want: [1 2], got: %v", c.GodIDs)
+	}
+	if time.Duration(c.BackupInterval) != 24*time.Hour {
+		t.Fatalf("backupInterval - want: %s, got: %s", 24*time.Hour, time.Duration(c.BackupInterval))
+	}
+	if c.Migrations != Default().Migrations {
+		t.Fatalf("migrations - want: %q, got: %q", Default().Migrations, c.Migrations)
+	}
+
+	err = c.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadGodID(t *testing.T) {
+	path := writeFile(t, "config.json", `{"godID": 7}`)
+
+	c, err := Load([]string{path}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.GodIDs) != 1 || c.GodIDs[0] != 7 || c.GodID != 0 {
+		t.Fatalf("godIDs - want: [7], got: %v (godID %d)", c.GodIDs, c.GodID)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	typo := writeFile(t, "config.json", `{"botTokn": "1:a"}`)
+	_, err := Load([]string{typo}, env(nil))
+	if err == nil || !strings.Contains(err.Error(), "botTokn") {
+		t.Fatalf("unknown field - want error naming botTokn, got: %v", err)
+	}
+
+	_, err = Load(nil, env(map[string]string{
+		EnvPrefix + "WORKERS":         "muitos",
+		EnvPrefix + "BOT_TOKEN_FILE":  "/does/not/exist",
+		EnvPrefix + "BACKUP_INTERVAL": "1 dia",
+	}))
+	for _, want := range []string{EnvPrefix + "WORKERS", EnvPrefix + "BOT_TOKEN_FILE", EnvPrefix + "BACKUP_INTERVAL"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("env - want error naming %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(c *Config)
+		field string
+	}{
+		{"bot token", func(c *Config) { c.BotToken = "abc" }, "botToken"},
+		{"god id", func(c *Config) { c.GodIDs = []int64{0} }, "godIDs"},
+		{"openai url", func(c *Config) { c.OpenAIBaseURL = "ftp://x" }, "openAIBaseURL"},
+		{"log level", func(c *Config) { c.LogLevel = "trace" }, "logLevel"},
+		{"workers", func(c *Config) { c.Workers = 0 }, "workers"},
+		{"backup interval", func(c *Config) { c.BackupInterval = Duration(time.Second) }, "backupInterval"},
+		{"backup keep", func(c *Config) { c.BackupKeep = 0 }, "backupKeep"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := Default()
+			test.edit(&c)
+			err := c.Validate()
+			if err == nil || !strings.Contains(err.Error(), test.field) {
+				t.Fatalf("want error about %s, got: %v", test.field, err)
+			}
+		})
+	}
+
+	// the token is never shown
+	c := Default()
+	c.BotToken = "secret-token"
+	if err := c.Validate(); err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("want error without the token, got: %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.BotToken = "1:abc"
+	c.OpenAIKey = "sk-abc"
+	c.BackupPassphrase = "senha"
+
+	r := c.Redacted()
+	if r.BotToken != redacted || r.OpenAIKey != redacted || r.BackupPassphrase != redacted || Default().Redacted().OpenAIKey != "" {
+		t.Fatalf("redacted - want tokens redacted and empty secrets kept empty, got: %+v", r)
+	}
+	if c.BotToken != "1:abc" {
+		t.Fatal("Redacted changed the config")
+	}
+}
@@ -0,0 +1,369 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+const (
+	audioPageSize    = 20
+	maxAudioNameLen  = 32
+	maxAudioTags     = 10
+	audioNotFoundMsg = "não existe áudio com esse nome. veja a lista com /audios"
+)
+
+func (h Controller) SaveAudio(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAudio)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	if args.Reply.Voice == nil {
+		return bh.Reply{
+			Text: "tem que ser uma mensagem de voz",
+		}
+	}
+
+	name := audioName(args.Get("nome"))
+	if err := validateAudioName(name); err != nil {
+		return err
+	}
+
+	tags := []string{}
+	for _, tag := range args.List("tags") {
+		if tag = audioName(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxAudioTags {
+		return bh.Reply{
+			Text: fmt.Sprintf("no máximo %d tags", maxAudioTags),
+		}
+	}
+
+	// the transcription of the voice, if it was saved for /cask
+	label := ""
+	msg, err := h.Repo.FindMessage(context.TODO(), u.Message.Chat.ID, u.Message.ReplyToMessage.MessageID)
+	if err == nil && msg.ContentType == repo.ContentTypeVoice {
+		label = msg.Text
+	}
+
+	// voices posted by a channel or an anonymous admin have no author
+	authorID := int64(0)
+	if from := u.Message.ReplyToMessage.From; from != nil {
+		authorID = from.ID
+	}
+
+	err = h.Repo.SaveVoice(repo.Voice{
+		ChatID:      u.Message.Chat.ID,
+		FileID:      u.Message.ReplyToMessage.Voice.FileID,
+		UserID:      authorID,
+		SavedBy:     u.Message.From.ID,
+		SavedByName: u.Message.From.FirstName,
+		Name:        name,
+		Label:       label,
+		Tags:        tags,
+	})
+	if errors.Is(err, repo.ErrVoiceNameTaken) {
+		return bh.Reply{
+			Text: "já existe um áudio com esse nome",
+		}
+	}
+	if errors.Is(err, repo.ErrVoiceAlreadySaved) {
+		return bh.Reply{
+			Text: "esse áudio já foi salvo",
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return bh.Reply{
+		Text: fmt.Sprintf("áudio salvo como %s", name),
+	}
+}
+
+// SendRandomAudio sends a random audio, optionally only from the given tag
+func (h Controller) SendRandomAudio(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAudio)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	tag := audioName(args.Get("tag"))
+
+	voice, err := h.Repo.FindRandomVoice(u.Message.Chat.ID, tag)
+	if errors.Is(err, repo.ErrNotFound) {
+		txt := "nenhum áudio salvo para mandar"
+		if tag != "" {
+			txt = "nenhum áudio com essa tag"
+		}
+		return bh.Reply{
+			Text: txt,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.sendAudio(s, u, voice)
+}
+
+// SendAudio sends the audio with the given name
+func (h Controller) SendAudio(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAudio)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	voice, err := h.Repo.FindVoice(context.TODO(), u.Message.Chat.ID, audioName(args.Get("nome")))
+	if errors.Is(err, repo.ErrNotFound) {
+		return bh.Reply{
+			Text: audioNotFoundMsg,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.sendAudio(s, u, voice)
+}
+
+func (h Controller) sendAudio(s bot.Service, u bot.Update, voice *repo.Voice) error {
+	_, err := s.SendVoice(bot.SendVoiceParams{
+		ChatID:           u.Message.Chat.ID,
+		Voice:            voice.FileID,
+		ReplyToMessageID: u.Message.MessageID,
+	})
+	return err
+}
+
+// ListAudios lists the audios of the chat by name
+func (h Controller) ListAudios(s bot.Service, u bot.Update) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAudio)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	txt, markup, err := h.audiosPage(u.Message.Chat.ID, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.SendMessage(bot.SendMessageParams{
+		ChatID:                   u.Message.Chat.ID,
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		Text:                     txt,
+		ParseMode:                "HTML",
+		ReplyMarkup:              markup,
+	})
+	return err
+}
+
+// AudiosPage handles the pagination buttons of /audios
+func (h Controller) AudiosPage(s bot.Service, cq *bot.CallbackQuery) error {
+	if cq.Message == nil {
+		return bh.Reply{
+			Text: "mensagem muito antiga. use /audios de novo",
+		}
+	}
+
+	page, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "audios:"))
+	if err != nil || page < 0 {
+		return bh.Reply{
+			Text: "página inválida",
+		}
+	}
+
+	txt, markup, err := h.audiosPage(cq.Message.Chat.ID, page)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.EditMessageText(bot.EditMessageTextParams{
+		ChatID:      cq.Message.Chat.ID,
+		MessageID:   cq.Message.MessageID,
+		Text:        txt,
+		ParseMode:   "HTML",
+		ReplyMarkup: markup,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.AnswerCallbackQuery(bot.AnswerCallbackQueryParams{
+		CallbackQueryID: cq.ID,
+	})
+}
+
+func (h Controller) audiosPage(chatID int64, page int) (string, *bot.InlineKeyboardMarkup, error) {
+	// one extra audio tells if there is a next page
+	voices, err := h.Repo.FindVoices(context.TODO(), chatID, audioPageSize+1, page*audioPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	hasNext := len(voices) > audioPageSize
+	if hasNext {
+		voices = voices[:audioPageSize]
+	}
+
+	if len(voices) == 0 {
+		return "nenhum áudio salvo. salve com /a <nome> respondendo a uma mensagem de voz", nil, nil
+	}
+
+	txt := fmt.Sprintf("áudios (página %d)\n\n", page+1)
+	for _, v := range voices {
+		txt += "- <b>" + html.EscapeString(v.Name) + "</b>"
+		for _, tag := range v.Tags {
+			txt += " #" + html.EscapeString(tag)
+		}
+		txt += "\n"
+	}
+
+	buttons := []bot.InlineKeyboardButton{}
+	if page > 0 {
+		buttons = append(buttons, bot.InlineKeyboardButton{
+			Text:         "◀️",
+			CallbackData: fmt.Sprintf("audios:%d", page-1),
+		})
+	}
+	if hasNext {
+		buttons = append(buttons, bot.InlineKeyboardButton{
+			Text:         "▶️",
+			CallbackData: fmt.Sprintf("audios:%d", page+1),
+		})
+	}
+
+	var markup *bot.InlineKeyboardMarkup
+	if len(buttons) > 0 {
+		markup = &bot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]bot.InlineKeyboardButton{buttons},
+		}
+	}
+
+	return txt, markup, nil
+}
+
+// RenameAudio renames an audio. Only who saved it or an admin can rename it.
+func (h Controller) RenameAudio(s bot.Service, u bot.Update, args bh.Args) error {
+	name := audioName(args.Get("nome"))
+	newName := audioName(args.Get("novo nome"))
+
+	err := h.requireAudioOwner(s, u, name)
+	if err != nil {
+		return err
+	}
+
+	if err := validateAudioName(newName); err != nil {
+		return err
+	}
+
+	err = h.Repo.RenameVoice(context.TODO(), u.Message.Chat.ID, name, newName)
+	if errors.Is(err, repo.ErrVoiceNameTaken) {
+		return bh.Reply{
+			Text: "já existe um áudio com esse nome",
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return bh.Reply{
+		Text: fmt.Sprintf("áudio renomeado para %s", newName),
+	}
+}
+
+// DeleteAudio deletes an audio. Only who saved it or an admin can delete it.
+func (h Controller) DeleteAudio(s bot.Service, u bot.Update, args bh.Args) error {
+	name := audioName(args.Get("nome"))
+
+	err := h.requireAudioOwner(s, u, name)
+	if err != nil {
+		return err
+	}
+
+	err = h.Repo.DeleteVoice(context.TODO(), u.Message.Chat.ID, name)
+	if err != nil {
+		return err
+	}
+
+	return bh.Reply{
+		Text: "áudio apagado",
+	}
+}
+
+// requireAudioOwner fails with a bh.Reply unless the audio exists and the
+// user saved it or is an admin
+func (h Controller) requireAudioOwner(s bot.Service, u bot.Update, name string) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAudio)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	voice, err := h.Repo.FindVoice(context.TODO(), u.Message.Chat.ID, name)
+	if errors.Is(err, repo.ErrNotFound) {
+		return bh.Reply{
+			Text: audioNotFoundMsg,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if voice.SavedBy == u.Message.From.ID {
+		return nil
+	}
+
+	isAdmin, err := h.isAdmin(s, u)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return bh.Reply{
+			Text: "só quem salvou o áudio ou um admin pode fazer isso",
+		}
+	}
+	return nil
+}
+
+// audioName normalizes names and tags: lower case, without a leading # and
+// with spaces replaced by _
+func audioName(name string) string {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "#")
+	return strings.Join(strings.Fields(name), "_")
+}
+
+func validateAudioName(name string) error {
+	if name == "" {
+		return bh.Reply{
+			Text: "nome vazio",
+		}
+	}
+	if utf8.RuneCountInString(name) > maxAudioNameLen {
+		return bh.Reply{
+			Text: fmt.Sprintf("nome muito longo (máximo %d caracteres)", maxAudioNameLen),
+		}
+	}
+	return nil
+}
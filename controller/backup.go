@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/backup"
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// bots can send documents up to 50MB
+const maxDocumentSize = 50 << 20
+
+// Backup makes a backup of the database and sends it to the god that asked
+func (h Controller) Backup(s bot.Service, u bot.Update) error {
+	path, err := h.backup(context.TODO())
+	if err != nil {
+		return err
+	}
+	return sendBackup(s, u.Message.Chat.ID, path)
+}
+
+// RunBackups makes a backup every interval and sends it to the gods.
+// The interval counts from the newest backup in the backup dir, so restarting
+// the bot neither skips nor repeats backups. It runs until ctx is done.
+func (h Controller) RunBackups(ctx context.Context, s bot.Service, interval time.Duration) {
+	last, err := backup.Last(h.Config.BackupDir)
+	if err != nil {
+		log.Print("backup: ", err)
+	}
+	next := last.Add(interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		// a failed backup is only tried again in the next interval
+		next = time.Now().Add(interval)
+
+		path, err := h.backup(ctx)
+		if err != nil {
+			log.Print("backup: ", err)
+			continue
+		}
+
+		for _, id := range h.Config.GodIDs {
+			err = sendBackup(s, id, path)
+			if err != nil {
+				log.Printf("backup: send to %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// backup writes a new backup to the backup dir and removes the old ones
+func (h Controller) backup(ctx context.Context) (string, error) {
+	start := time.Now()
+	path, err := backup.Create(ctx, h.Repo, h.Config.BackupDir, h.Config.BackupPassphrase, start)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("backup: %s in %s", path, time.Since(start).Round(time.Millisecond))
+
+	removed, err := backup.Rotate(h.Config.BackupDir, h.Config.BackupKeep)
+	if err != nil {
+		// the new backup is fine anyway
+		log.Print("backup: rotate: ", err)
+	}
+	for _, old := range removed {
+		log.Print("backup: removed ", old)
+	}
+
+	return path, nil
+}
+
+func sendBackup(s bot.Service, chatID int64, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > maxDocumentSize {
+		_, err = s.SendMessage(bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("o backup tem %d MB, grande demais para mandar. ficou salvo em %s", info.Size()>>20, path),
+		})
+		return err
+	}
+
+	return s.SendDocument(bot.SendDocumentParams{
+		ChatID:   chatID,
+		FileName: path,
+		Caption:  filepath.Base(path),
+	})
+}
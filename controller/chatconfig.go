@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+const chatConfigText = "configurações do grupo. toque para ativar ou desativar:\n\n" +
+	"ATENÇÃO! com o /cask ativado, as mensagens de texto são salvas no banco de dados do bot " +
+	"e as mensagens de voz são transcritas pela OpenAI"
+
+// ChatConfig shows the switches of the chat as buttons that toggle them
+func (h Controller) ChatConfig(s bot.Service, u bot.Update) error {
+	markup, err := h.chatConfigKeyboard(u.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.SendMessage(bot.SendMessageParams{
+		ChatID:                   u.Message.Chat.ID,
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		Text:                     chatConfigText,
+		ReplyMarkup:              markup,
+	})
+	return err
+}
+
+// ChatConfigToggle handles the buttons of /config. Only admins can use them.
+func (h Controller) ChatConfigToggle(s bot.Service, cq *bot.CallbackQuery) error {
+	if cq.Message == nil {
+		return s.AnswerCallbackQuery(bot.AnswerCallbackQueryParams{
+			CallbackQueryID: cq.ID,
+			Text:            "mensagem muito antiga. use /config de novo",
+		})
+	}
+
+	isAdmin, err := h.isAdmin(s, bot.Update{CallbackQuery: cq})
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return bh.Reply{
+			Text: "só admins podem mudar as configurações",
+		}
+	}
+
+	// the button has the state it sets, so two admins tapping it at the same
+	// time don't undo each other
+	name, state, _ := strings.Cut(strings.TrimPrefix(cq.Data, "config:"), ":")
+	f := repo.Feature(name)
+	_, err = repo.LookupFeature(f)
+	if err != nil || (state != "on" && state != "off") {
+		return bh.Reply{
+			Text: "configuração desconhecida. use /config de novo",
+		}
+	}
+	enabled := state == "on"
+
+	chatID := cq.Message.Chat.ID
+	err = h.Repo.SetChatFeature(context.TODO(), chatID, f, enabled)
+	if err != nil {
+		return err
+	}
+
+	markup, err := h.chatConfigKeyboard(chatID)
+	if err != nil {
+		return err
+	}
+	_, err = s.EditMessageText(bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   cq.Message.MessageID,
+		Text:        chatConfigText,
+		ReplyMarkup: markup,
+	})
+	if err != nil {
+		return err
+	}
+
+	txt := "desativado"
+	if enabled {
+		txt = "ativado"
+	}
+	return s.AnswerCallbackQuery(bot.AnswerCallbackQueryParams{
+		CallbackQueryID: cq.ID,
+		Text:            txt,
+	})
+}
+
+// chatConfigKeyboard has a button for each feature, showing if it is on.
+// The callback data is config:<feature>:on|off, the state the button sets.
+func (h Controller) chatConfigKeyboard(chatID int64) (*bot.InlineKeyboardMarkup, error) {
+	features, err := h.Repo.FindChatFeatures(context.TODO(), chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	markup := &bot.InlineKeyboardMarkup{}
+	for _, info := range repo.Features {
+		icon, toggle := "❌", "on"
+		if features[info.Feature] {
+			icon, toggle = "✅", "off"
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, []bot.InlineKeyboardButton{{
+			Text:         icon + " " + info.Description,
+			CallbackData: "config:" + string(info.Feature) + ":" + toggle,
+		}})
+	}
+	return markup, nil
+}
@@ -1,17 +1,13 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
-	"os/exec"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +17,7 @@ import (
 	"github.com/igoracmelo/euperturbot/config"
 	"github.com/igoracmelo/euperturbot/openai"
 	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/sed"
 	"github.com/igoracmelo/euperturbot/util"
 )
 
@@ -29,9 +26,15 @@ type Controller struct {
 	OpenAI  openai.Service
 	BotInfo *bot.User
 	Config  *config.Config
+	Inline  *InlineCoordinator
+	Members *MemberCache
+	// Transcriptions queues the voices saved for /cask
+	Transcriptions *TranscriptionQueue
+	// Commands is used by /help
+	Commands *bh.CommandRegistry
 }
 
-func (h Controller) Start(s bot.Service, u bot.Update) error {
+func (h Controller) Start(s bot.Service, u bot.Update, args bh.Args) error {
 	err := h.Repo.SaveChat(context.TODO(), repo.Chat{
 		ID:    u.Message.Chat.ID,
 		Title: u.Message.Chat.Name(),
@@ -40,27 +43,23 @@ func (h Controller) Start(s bot.Service, u bot.Update) error {
 		return err
 	}
 
+	txt := "vamo que vamo"
+	// sent by the inline mode button
+	if args.Get("parâmetro") == inlineStartParameter {
+		txt = inlineHelp
+	}
+
 	_, err = s.SendMessage(bot.SendMessageParams{
 		ChatID:                   u.Message.Chat.ID,
 		ReplyToMessageID:         u.Message.MessageID,
-		Text:                     "vamo que vamo",
+		Text:                     txt,
 		AllowSendingWithoutReply: true,
 	})
 	return err
 }
 
-func (h Controller) SubToTopic(s bot.Service, u bot.Update) error {
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	topics := []string{}
-	if len(fields) > 1 {
-		topics = strings.Split(fields[1], "\n")
-	}
-
-	if len(topics) == 0 {
-		return bh.Reply{
-			Text: "cadê o(s) tópico(s)?",
-		}
-	}
+func (h Controller) SubToTopic(s bot.Service, u bot.Update, args bh.Args) error {
+	topics := args.List("tópicos")
 
 	if len(topics) > 3 {
 		return bh.Reply{
@@ -103,7 +102,7 @@ func (h Controller) SubToTopic(s bot.Service, u bot.Update) error {
 			return err
 		}
 
-		enablesCreatingTopic, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "create_topics")
+		enablesCreatingTopic, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureCreateTopics)
 		isAdmin, _ := h.isAdmin(s, u)
 		if !exists && !isAdmin && !enablesCreatingTopic {
 			return bh.Reply{
@@ -134,14 +133,10 @@ func (h Controller) SubToTopic(s bot.Service, u bot.Update) error {
 	}
 }
 
-func (h Controller) UnsubTopic(s bot.Service, u bot.Update) error {
+func (h Controller) UnsubTopic(s bot.Service, u bot.Update, args bh.Args) error {
 	log.Print(u.Message.Text)
 
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	topic := ""
-	if len(fields) > 1 {
-		topic = fields[1]
-	}
+	topic := args.Get("tópico")
 
 	if err := validateTopic(topic); err != nil {
 		return err
@@ -172,36 +167,58 @@ func (h Controller) UnsubTopic(s bot.Service, u bot.Update) error {
 	}
 }
 
-func (h Controller) CreatePoll(s bot.Service, u bot.Update) error {
+func (h Controller) CreatePoll(s bot.Service, u bot.Update, args bh.Args) error {
 	log.Print(username(u.Message.From) + ": " + u.Message.Text)
 
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	question := ""
-	if len(fields) > 1 {
-		question = strings.TrimSpace(fields[1])
-	}
-
-	if question == "" {
-		return fmt.Errorf("cade o titulo joe")
-	}
+	question := args.Get("pergunta")
 
-	_, err := s.SendPoll(bot.SendPollParams{
+	msg, err := s.SendPoll(bot.SendPollParams{
 		ChatID:      u.Message.Chat.ID,
 		Question:    question,
 		Options:     []string{"👍🏿", "👎🏻"},
 		IsAnonymous: util.ToPtr(false),
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	if msg.Poll == nil {
+		return nil
+	}
+
+	// the options are in the order of the votes, so answers are saved as votes
+	return h.Repo.SavePoll(repo.Poll{
+		ID:              msg.Poll.ID,
+		ChatID:          u.Message.Chat.ID,
+		Topic:           question,
+		ResultMessageID: msg.MessageID,
+	})
 }
 
-func (h Controller) CallSubs(s bot.Service, u bot.Update) error {
-	log.Print(username(u.Message.From) + ": " + u.Message.Text)
+// PollAnswer saves the votes of the polls made with /pollo. Retracted votes
+// come with no options.
+func (h Controller) PollAnswer(s bot.Service, answer *bot.PollAnswer) error {
+	poll, err := h.Repo.FindPoll(answer.PollID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	topic := ""
-	if len(fields) > 1 {
-		topic = fields[1]
+	if len(answer.OptionIDs) == 0 {
+		return h.Repo.DeletePollVote(poll.ID, answer.User.ID)
 	}
+	return h.Repo.SavePollVote(repo.PollVote{
+		PollID: poll.ID,
+		UserID: answer.User.ID,
+		Vote:   answer.OptionIDs[0],
+	})
+}
+
+func (h Controller) CallSubs(s bot.Service, u bot.Update, args bh.Args) error {
+	log.Print(username(u.Message.From) + ": " + u.Message.Text)
+
+	topic := args.Get("tópico")
 
 	if err := validateTopic(topic); err != nil {
 		return bh.Reply{
@@ -212,14 +229,10 @@ func (h Controller) CallSubs(s bot.Service, u bot.Update) error {
 	return h.callSubs(s, u, topic, false)
 }
 
-func (h Controller) ListSubs(s bot.Service, u bot.Update) error {
+func (h Controller) ListSubs(s bot.Service, u bot.Update, args bh.Args) error {
 	log.Print(u.Message.Text)
 
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	topic := ""
-	if len(fields) > 1 {
-		topic = fields[1]
-	}
+	topic := args.Get("tópico")
 
 	if err := validateTopic(topic); err != nil {
 		return bh.Reply{
@@ -303,66 +316,8 @@ func (h Controller) ListChatTopics(s bot.Service, u bot.Update) error {
 	}
 }
 
-func (h Controller) SaveAudio(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "audio")
-	if !enables {
-		return bh.Reply{
-			Text: "comando desativado. ative com /enable_audio",
-		}
-	}
-
-	if u.Message.ReplyToMessage == nil {
-		return bh.Reply{
-			Text: "responda ao audio que quer salvar",
-		}
-	}
-
-	if u.Message.ReplyToMessage.Voice == nil {
-		return bh.Reply{
-			Text: "tem que ser uma mensagem de voz",
-		}
-	}
-
-	err := h.Repo.SaveVoice(repo.Voice{
-		FileID: u.Message.ReplyToMessage.Voice.FileID,
-		UserID: u.Message.ReplyToMessage.From.ID,
-		ChatID: u.Message.Chat.ID,
-	})
-	if err != nil {
-		return err
-	}
-
-	return bh.Reply{
-		Text: "áudio salvo",
-	}
-}
-
-func (h Controller) SendRandomAudio(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "audio")
-	if !enables {
-		return bh.Reply{
-			Text: "comando desativado. ative com /enable_audio",
-		}
-	}
-
-	voice, err := h.Repo.FindRandomVoice(u.Message.Chat.ID)
-	if errors.Is(err, sql.ErrNoRows) {
-		return bh.Reply{
-			Text: "nenhum áudio salvo para mandar",
-		}
-	}
-	if err != nil {
-		return err
-	}
-	_, err = s.SendVoice(bot.SendVoiceParams{
-		ChatID:           u.Message.Chat.ID,
-		Voice:            voice.FileID,
-		ReplyToMessageID: u.Message.MessageID,
-	})
-	return err
-}
-
-func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Message) error {
+// gptCompletion answers the question with ChatGPT and saves both for replies to the answer
+func (h Controller) gptCompletion(s bot.Service, u bot.Update, question string, msgs []openai.Message) error {
 	msg, err := s.SendMessage(bot.SendMessageParams{
 		ChatID:           u.Message.Chat.ID,
 		ReplyToMessageID: u.Message.MessageID,
@@ -378,29 +333,8 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 
 	var rateErr openai.ErrRateLimit
 	if errors.As(err, &rateErr) {
-		_, err = s.EditMessageText(bot.EditMessageTextParams{
-			ChatID:    u.Message.Chat.ID,
-			MessageID: msg.MessageID,
-			Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", int(rateErr)),
-		})
-		go func() {
-			deadline := time.Now().Add(time.Duration(rateErr) * time.Second)
-			for time.Now().Before(deadline) {
-				time.Sleep(time.Second)
-				secs := int(time.Until(deadline).Seconds())
-				_, _ = s.EditMessageText(bot.EditMessageTextParams{
-					ChatID:    u.Message.Chat.ID,
-					MessageID: msg.MessageID,
-					Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", secs),
-				})
-			}
-			_, _ = s.EditMessageText(bot.EditMessageTextParams{
-				ChatID:    u.Message.Chat.ID,
-				MessageID: msg.MessageID,
-				Text:      "manda de novo ae",
-			})
-		}()
-		return err
+		go h.rateLimitCountdown(s, u.Message.Chat.ID, msg.MessageID)
+		return nil
 	}
 	if err != nil {
 		_, _ = s.EditMessageText(bot.EditMessageTextParams{
@@ -420,8 +354,6 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 		return err
 	}
 
-	txt := strings.TrimPrefix(strings.TrimPrefix(u.Message.Text, "/cask "), "/ask ")
-
 	replyTo := 0
 	if u.Message.ReplyToMessage != nil {
 		replyTo = u.Message.ReplyToMessage.MessageID
@@ -429,10 +361,11 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 	err = h.Repo.SaveMessage(context.TODO(), repo.Message{
 		ID:               u.Message.MessageID,
 		ChatID:           u.Message.Chat.ID,
-		Text:             txt,
+		Text:             question,
 		Date:             time.Unix(u.Message.Date, 0),
 		UserID:           u.Message.From.ID,
 		ReplyToMessageID: replyTo,
+		ContentType:      repo.ContentTypeText,
 	})
 	if err != nil {
 		return err
@@ -445,22 +378,18 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 		Date:             time.Unix(msg.Date, 0),
 		UserID:           h.Config.GPTUserID,
 		ReplyToMessageID: u.Message.MessageID,
+		ContentType:      repo.ContentTypeText,
 	})
 	return err
 }
 
-func (h Controller) GPTCompletion(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "ask")
+func (h Controller) GPTCompletion(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAsk)
 	if !enables {
 		return nil
 	}
 
-	chunks := strings.SplitN(u.Message.Text, " ", 2)
-	if len(chunks) != 2 {
-		return bh.Reply{
-			Text: "faltou a pergunta",
-		}
-	}
+	question := args.Get("pergunta")
 
 	name := username(u.Message.From)
 
@@ -469,28 +398,23 @@ func (h Controller) GPTCompletion(s bot.Service, u bot.Update) error {
 			Content: fmt.Sprintf(
 				"%s: %s",
 				name,
-				chunks[1],
+				question,
 			),
 		},
 	}
 
-	return h.gptCompletion(s, u, msgs)
+	return h.gptCompletion(s, u, question, msgs)
 }
 
-func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "cask")
+func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureCAsk)
 	if !enables {
 		return bh.Reply{
-			Text: "comando desativado. ative com /enable_cask\nATENÇÃO! Ao ativar essa opção, as mensagens de texto serão salvas no banco de dados do s",
+			Text: "comando desativado. um admin pode ativar em /config\nATENÇÃO! Ao ativar essa opção, as mensagens de texto serão salvas no banco de dados do s",
 		}
 	}
 
-	chunks := strings.SplitN(u.Message.Text, " ", 2)
-	if len(chunks) != 2 {
-		return bh.Reply{
-			Text: "faltou a pergunta",
-		}
-	}
+	question := args.Get("pergunta")
 
 	date := time.Unix(u.Message.Date, 0)
 	if u.Message.ReplyToMessage != nil {
@@ -508,14 +432,37 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 		title = u.Message.Chat.FirstName
 	}
 
-	prepMsgs := prepareMessagesForGPT(msgs)
+	optedOut, err := h.optedOutUsers(u.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	prepMsgs := prepareMessagesForGPT(msgs, optedOut)
 	if len(prepMsgs) == 0 {
 		return bh.Reply{
 			Text: "ainda não há mensagens salvas para usar o /cask",
 		}
 	}
 
-	prompts := []openai.Message{
+	prompts := []openai.Message{}
+
+	// old messages related to the question, so it can be answered even if the subject isn't recent.
+	// this is optional context, so failing to find them shouldn't fail the command.
+	related, err := h.relatedMessages(u.Message.Chat.ID, question, date, msgs)
+	if err != nil {
+		log.Print(err)
+	}
+	if relatedTxts := prepareMessagesForGPT(related, optedOut); len(relatedTxts) > 0 {
+		prompts = append(prompts, openai.Message{
+			Content: fmt.Sprintf(
+				"Mensagens antigas do chat %s relacionadas à pergunta, no formato '<usuario>: <texto>'\n\n%s",
+				title,
+				strings.Join(relatedTxts, "\n"),
+			),
+		})
+	}
+
+	prompts = append(prompts, []openai.Message{
 		{
 			Content: fmt.Sprintf(
 				"Mensagens recentes do chat %s para voce se contextualizar, no formato '<usuario>: <texto>'\n\n%s",
@@ -529,10 +476,10 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 				name,
 				title,
 				name,
-				chunks[1],
+				question,
 			),
 		},
-	}
+	}...)
 
 	msg, err := s.SendMessage(bot.SendMessageParams{
 		ChatID:           u.Message.Chat.ID,
@@ -549,24 +496,8 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 	})
 	var rateErr openai.ErrRateLimit
 	if errors.As(err, &rateErr) {
-		_, err = s.EditMessageText(bot.EditMessageTextParams{
-			ChatID:    u.Message.Chat.ID,
-			MessageID: msg.MessageID,
-			Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", int(rateErr)),
-		})
-		go func() {
-			deadline := time.Now().Add(time.Duration(rateErr) * time.Second)
-			for time.Now().Before(deadline) {
-				time.Sleep(time.Second)
-				secs := int(time.Until(deadline).Seconds())
-				_, _ = s.EditMessageText(bot.EditMessageTextParams{
-					ChatID:    u.Message.Chat.ID,
-					MessageID: msg.MessageID,
-					Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", secs),
-				})
-			}
-		}()
-		return err
+		go h.rateLimitCountdown(s, u.Message.Chat.ID, msg.MessageID)
+		return nil
 	}
 	if err != nil {
 		return err
@@ -580,39 +511,6 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 	return err
 }
 
-func (h Controller) Enable(opt string) bh.HandlerFunc {
-	return func(s bot.Service, u bot.Update) error {
-		err := h.Repo.ChatEnable(context.TODO(), u.Message.Chat.ID, opt)
-		if err != nil {
-			return err
-		}
-
-		return bh.Reply{
-			Text: "ativado",
-		}
-	}
-}
-
-func (h Controller) Disable(opt string) bh.HandlerFunc {
-	return func(s bot.Service, u bot.Update) error {
-		err := h.Repo.ChatDisable(context.TODO(), u.Message.Chat.ID, opt)
-		if err != nil {
-			return err
-		}
-
-		return bh.Reply{
-			Text: "desativado",
-		}
-	}
-}
-
-func (h Controller) Backup(s bot.Service, u bot.Update) error {
-	return s.SendDocument(bot.SendDocumentParams{
-		ChatID:   h.Config.GodID,
-		FileName: "./euperturbot.db",
-	})
-}
-
 // WIP
 func (h Controller) Xonotic(s bot.Service, u bot.Update) error {
 	type XonoticResponse []struct {
@@ -671,21 +569,21 @@ func (h Controller) Xonotic(s bot.Service, u bot.Update) error {
 	return err
 }
 
-func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
+func (h Controller) CallbackQuery(s bot.Service, cq *bot.CallbackQuery) error {
 	var err error
 
-	poll, err := h.Repo.FindPollByMessage(u.CallbackQuery.Message.MessageID)
+	poll, err := h.Repo.FindPollByMessage(cq.Message.MessageID)
 	if err != nil {
 		return err
 	}
 
-	voteNum, err := strconv.Atoi(u.CallbackQuery.Data)
+	voteNum, err := strconv.Atoi(cq.Data)
 	if err != nil {
 		return err
 	}
 
 	// TODO: improve this logic
-	vote, err := h.Repo.FindPollVote(poll.ID, u.CallbackQuery.From.ID)
+	vote, err := h.Repo.FindPollVote(poll.ID, cq.From.ID)
 	if errors.Is(err, sql.ErrNoRows) {
 		vote = nil
 	} else if err != nil {
@@ -697,7 +595,7 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 	} else {
 		err = h.Repo.SavePollVote(repo.PollVote{
 			PollID: poll.ID,
-			UserID: u.CallbackQuery.From.ID,
+			UserID: cq.From.ID,
 			Vote:   voteNum,
 		})
 	}
@@ -708,7 +606,7 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 	if voteNum == repo.VoteUp {
 		err = h.Repo.SaveUserTopic(repo.UserTopic{
 			ChatID: poll.ChatID,
-			UserID: u.CallbackQuery.From.ID,
+			UserID: cq.From.ID,
 			Topic:  poll.Topic,
 		})
 		if err != nil {
@@ -723,7 +621,7 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 
 	found := false
 	for _, user := range users {
-		if user.ID == u.CallbackQuery.From.ID {
+		if user.ID == cq.From.ID {
 			found = true
 			break
 		}
@@ -796,34 +694,18 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 
 func (h Controller) Text(s bot.Service, u bot.Update) error {
 	// sed commands
-	re := regexp.MustCompile(`^(s|y)\/.*\/`)
-	if re.MatchString(u.Message.Text) && u.Message.ReplyToMessage != nil {
-		enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "sed")
+	if sed.IsScript(u.Message.Text) && u.Message.ReplyToMessage != nil {
+		enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureSed)
 		if !enables {
 			return nil
 		}
 
-		cmd := exec.CommandContext(context.TODO(), "sed", "--sandbox", "-E", u.Message.Text)
-		buf := &bytes.Buffer{}
-		cmd.Stdout = buf
-		cmd.Stdin = strings.NewReader(u.Message.ReplyToMessage.Text)
-
-		err := cmd.Run()
-		if err != nil {
-			return err
-		}
-
-		_, err = s.SendMessage(bot.SendMessageParams{
-			ChatID:           u.Message.Chat.ID,
-			ReplyToMessageID: u.Message.ReplyToMessage.MessageID,
-			Text:             buf.String(),
-		})
-		return err
+		return h.runSed(s, u)
 	}
 
 	// if reply to chatGPT, treat as /ask
 	if u.Message.ReplyToMessage != nil && u.Message.ReplyToMessage.From.ID == h.BotInfo.ID {
-		enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "ask")
+		enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAsk)
 		if !enables {
 			return nil
 		}
@@ -868,7 +750,7 @@ func (h Controller) Text(s bot.Service, u bot.Update) error {
 			),
 		})
 
-		return h.gptCompletion(s, u, oaiMsgs)
+		return h.gptCompletion(s, u, u.Message.Text, oaiMsgs)
 	}
 
 	// call subscribers
@@ -880,95 +762,10 @@ func (h Controller) Text(s bot.Service, u bot.Update) error {
 		return h.callSubs(s, u, txt, true)
 	}
 
-	// save message
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "cask")
-	if !enables {
-		return nil
-	}
-
-	name := username(u.Message.From)
-	id := u.Message.From.ID
-
-	if u.Message.FowardFrom != nil {
-		name = username(u.Message.FowardFrom) + "(forward)"
-		id = u.Message.FowardFrom.ID
-	}
-
-	if u.Message.ForwardSenderName != "" {
-		id = 0
-		name = sanitizeUsername(u.Message.ForwardSenderName)
-	}
-
-	replyID := 0
-	if u.Message.ReplyToMessage != nil {
-		replyID = u.Message.ReplyToMessage.MessageID
-	}
-
-	err := h.Repo.SaveMessage(context.TODO(), repo.Message{
-		ID:               u.Message.MessageID,
-		ReplyToMessageID: replyID,
-		ChatID:           u.Message.Chat.ID,
-		Text:             txt,
-		Date:             time.Unix(u.Message.Date, 0),
-		UserID:           id,
-		UserName:         name,
-	})
-
-	return err
+	return h.saveMessage(s, u.Message)
 }
 
-// TODO:
-func (h Controller) InlineQuery(s bot.Service, u bot.Update) error {
-	var err error
-
-	// TODO: debounce by u.InlineQuery.ID
-	util.Debounce(5*time.Second, func() {
-		var resp *openai.CompletionResponse
-		resp, err = h.OpenAI.Completion(&openai.CompletionParams{
-			WaitRateLimit: true,
-			Messages: []openai.Message{
-				{
-					Content: u.InlineQuery.Query,
-				},
-			},
-		})
-
-		if err != nil {
-			_ = s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
-				InlineQueryID: u.InlineQuery.ID,
-				Results: []bot.InlineQueryResult{
-					{
-						Type:  "article",
-						ID:    "1",
-						Title: "Erro ao perguntar ao ChatGPT",
-						InputMessageContent: bot.InputMessageContent{
-							MessageText: "",
-						},
-					},
-				},
-			})
-			return
-		}
-
-		title := resp.Choices[0].Message.Content
-		if len(title) > 100 {
-			title = title[:97] + "..."
-		}
-
-		err = s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
-			InlineQueryID: u.InlineQuery.ID,
-			Results: []bot.InlineQueryResult{
-				{
-					Type:  "article",
-					ID:    fmt.Sprintf("%016X", rand.Int63()),
-					Title: title,
-					InputMessageContent: bot.InputMessageContent{
-						MessageText: resp.Choices[0].Message.Content,
-					},
-				},
-			},
-		})
-	})()
-
-	return err
+// Media saves messages that aren't plain text, like photos and stickers
+func (h Controller) Media(s bot.Service, msg *bot.Message) error {
+	return h.saveMessage(s, msg)
 }
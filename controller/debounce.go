@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InlineCoordinator debounces the inline queries of each user. Telegram sends
+// a new query on every keystroke, so only the last one is answered: a new
+// query from the same user cancels the one waiting or in flight. Answers are
+// cached by query text.
+type InlineCoordinator struct {
+	delay time.Duration
+	ttl   time.Duration
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+
+	mut     *sync.Mutex
+	lastID  uint64
+	pending map[int64]pendingQuery
+	cache   map[string]cachedAnswer
+}
+
+type pendingQuery struct {
+	id     uint64
+	cancel context.CancelFunc
+}
+
+type cachedAnswer struct {
+	answer  string
+	expires time.Time
+}
+
+func NewInlineCoordinator(delay time.Duration, ttl time.Duration) *InlineCoordinator {
+	return &InlineCoordinator{
+		delay:   delay,
+		ttl:     ttl,
+		now:     time.Now,
+		after:   time.After,
+		mut:     new(sync.Mutex),
+		pending: map[int64]pendingQuery{},
+		cache:   map[string]cachedAnswer{},
+	}
+}
+
+// Do waits for the user to stop typing and then calls fn, unless a newer query
+// from the same user arrives, in which case it returns context.Canceled.
+// Cached answers are returned right away.
+func (c *InlineCoordinator) Do(userID int64, query string, fn func(ctx context.Context) (string, error)) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(query))
+
+	c.mut.Lock()
+	if prev, ok := c.pending[userID]; ok {
+		prev.cancel()
+		delete(c.pending, userID)
+	}
+
+	if cached, ok := c.cache[key]; ok && c.now().Before(cached.expires) {
+		c.mut.Unlock()
+		return cached.answer, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.lastID++
+	id := c.lastID
+	c.pending[userID] = pendingQuery{id: id, cancel: cancel}
+	c.mut.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-c.after(c.delay):
+	}
+
+	answer, err := fn(ctx)
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if p, ok := c.pending[userID]; ok && p.id == id {
+		delete(c.pending, userID)
+	}
+
+	// superseded while in flight, the answer is not wanted anymore
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.evictExpired()
+	c.cache[key] = cachedAnswer{
+		answer:  answer,
+		expires: c.now().Add(c.ttl),
+	}
+	return answer, nil
+}
+
+// evictExpired must be called with the lock held
+func (c *InlineCoordinator) evictExpired() {
+	now := c.now()
+	for k, v := range c.cache {
+		if !now.Before(v.expires) {
+			delete(c.cache, k)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mut    sync.Mutex
+	now    time.Time
+	timers []chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, ch)
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Fire fires the timer created by the n-th call of After, waiting for it to be created
+func (c *fakeClock) Fire(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mut.Lock()
+		if len(c.timers) > n {
+			c.timers[n] <- c.now
+			c.mut.Unlock()
+			return
+		}
+		c.mut.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timer %d was never created", n)
+}
+
+func newTestCoordinator() (*InlineCoordinator, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewInlineCoordinator(time.Second, time.Minute)
+	c.now = clock.Now
+	c.after = clock.After
+	return c, clock
+}
+
+type result struct {
+	answer string
+	err    error
+}
+
+func doAsync(c *InlineCoordinator, userID int64, query string, fn func(ctx context.Context) (string, error)) chan result {
+	ch := make(chan result, 1)
+	go func() {
+		answer, err := c.Do(userID, query, fn)
+		ch <- result{answer, err}
+	}()
+	return ch
+}
+
+func answerWith(answer string, calls *int, mut *sync.Mutex) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		mut.Lock()
+		*calls++
+		mut.Unlock()
+		return answer, nil
+	}
+}
+
+func TestInlineCoordinatorSupersedesWaitingQuery(t *testing.T) {
+	c, clock := newTestCoordinator()
+	mut := &sync.Mutex{}
+	calls := 0
+
+	first := doAsync(c, 1, "ol", answerWith("first", &calls, mut))
+	waitPending(t, c, 1)
+	second := doAsync(c, 1, "ola", answerWith("second", &calls, mut))
+
+	res := <-first
+	if !errors.Is(res.err, context.Canceled) {
+		t.Fatalf("first - want: %v, got: %v", context.Canceled, res.err)
+	}
+
+	clock.Fire(t, 1)
+	res = <-second
+	if res.err != nil || res.answer != "second" {
+		t.Fatalf("second - want: second, got: %q (%v)", res.answer, res.err)
+	}
+	if calls != 1 {
+		t.Fatalf("calls - want: 1, got: %d", calls)
+	}
+}
+
+func TestInlineCoordinatorCancelsInFlightQuery(t *testing.T) {
+	c, clock := newTestCoordinator()
+
+	started := make(chan struct{})
+	first := doAsync(c, 1, "ol", func(ctx context.Context) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	clock.Fire(t, 0)
+	<-started
+
+	second := doAsync(c, 1, "ola", func(ctx context.Context) (string, error) {
+		return "second", nil
+	})
+
+	res := <-first
+	if !errors.Is(res.err, context.Canceled) {
+		t.Fatalf("first - want: %v, got: %v", context.Canceled, res.err)
+	}
+
+	clock.Fire(t, 1)
+	res = <-second
+	if res.answer != "second" {
+		t.Fatalf("second - want: second, got: %q (%v)", res.answer, res.err)
+	}
+}
+
+func TestInlineCoordinatorUsersAreIndependent(t *testing.T) {
+	c, clock := newTestCoordinator()
+	mut := &sync.Mutex{}
+	calls := 0
+
+	first := doAsync(c, 1, "a", answerWith("a", &calls, mut))
+	waitPending(t, c, 1)
+	second := doAsync(c, 2, "b", answerWith("b", &calls, mut))
+	waitPending(t, c, 2)
+
+	clock.Fire(t, 0)
+	clock.Fire(t, 1)
+
+	for _, ch := range []chan result{first, second} {
+		res := <-ch
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("calls - want: 2, got: %d", calls)
+	}
+}
+
+func TestInlineCoordinatorCache(t *testing.T) {
+	c, clock := newTestCoordinator()
+	mut := &sync.Mutex{}
+	calls := 0
+
+	res := doAsync(c, 1, "Olá", answerWith("oi", &calls, mut))
+	clock.Fire(t, 0)
+	if r := <-res; r.answer != "oi" {
+		t.Fatalf("answer - want: oi, got: %q (%v)", r.answer, r.err)
+	}
+
+	// cached for everyone, ignoring case and surrounding spaces
+	answer, err := c.Do(2, " olá ", answerWith("oi", &calls, mut))
+	if err != nil || answer != "oi" {
+		t.Fatalf("cached - want: oi, got: %q (%v)", answer, err)
+	}
+	if calls != 1 {
+		t.Fatalf("calls - want: 1, got: %d", calls)
+	}
+
+	clock.Advance(time.Minute)
+
+	res = doAsync(c, 1, "olá", answerWith("oi de novo", &calls, mut))
+	clock.Fire(t, 1)
+	if r := <-res; r.answer != "oi de novo" {
+		t.Fatalf("expired - want: oi de novo, got: %q (%v)", r.answer, r.err)
+	}
+	if calls != 2 {
+		t.Fatalf("calls - want: 2, got: %d", calls)
+	}
+}
+
+func TestInlineCoordinatorDoesNotCacheErrors(t *testing.T) {
+	c, clock := newTestCoordinator()
+
+	res := doAsync(c, 1, "a", func(ctx context.Context) (string, error) {
+		return "", errors.New("boom")
+	})
+	clock.Fire(t, 0)
+	if r := <-res; r.err == nil {
+		t.Fatal("want error")
+	}
+
+	res = doAsync(c, 1, "a", func(ctx context.Context) (string, error) {
+		return "ok", nil
+	})
+	clock.Fire(t, 1)
+	if r := <-res; r.answer != "ok" {
+		t.Fatalf("answer - want: ok, got: %q (%v)", r.answer, r.err)
+	}
+}
+
+// waitPending waits until the user has a query waiting or in flight
+func waitPending(t *testing.T, c *InlineCoordinator, userID int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mut.Lock()
+		_, ok := c.pending[userID]
+		c.mut.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("user %d has no pending query", userID)
+}
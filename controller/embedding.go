@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+const embeddingBatchSize = 100
+
+// IndexEmbeddings computes the embeddings of saved messages in the background,
+// so /cask can find related old messages. It runs until ctx is done.
+func (h Controller) IndexEmbeddings(ctx context.Context, interval time.Duration) {
+	for {
+		n, err := h.indexEmbeddings(ctx)
+		if err != nil {
+			log.Print("index embeddings: ", err)
+		}
+
+		// keep going while there is a backlog of messages to index
+		if err == nil && n == embeddingBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (h Controller) indexEmbeddings(ctx context.Context) (int, error) {
+	msgs, err := h.Repo.FindMessagesWithoutEmbedding(ctx, embeddingBatchSize)
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+
+	embeddings, err := h.embedMessages(ctx, msgs)
+	if err != nil {
+		log.Print("index embeddings: batch failed, trying one by one: ", err)
+		return h.indexEmbeddingsOneByOne(ctx, msgs)
+	}
+
+	for _, e := range embeddings {
+		err = h.Repo.SaveMessageEmbedding(ctx, e)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(msgs), nil
+}
+
+// indexEmbeddingsOneByOne finds out which messages fail the batch. A single
+// message the API rejects fails the whole request, and it would be tried
+// again forever. Those are recorded, so the indexer gives up on them.
+func (h Controller) indexEmbeddingsOneByOne(ctx context.Context, msgs []repo.Message) (int, error) {
+	failed := []repo.Message{}
+	var embedErr error
+
+	for _, msg := range msgs {
+		embeddings, err := h.embedMessages(ctx, []repo.Message{msg})
+		if err != nil {
+			failed = append(failed, msg)
+			embedErr = err
+			continue
+		}
+
+		err = h.Repo.SaveMessageEmbedding(ctx, embeddings[0])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// if no message works, the API is the problem, not the messages
+	if len(failed) == len(msgs) {
+		return 0, embedErr
+	}
+
+	for _, msg := range failed {
+		err := h.Repo.SaveMessageEmbeddingFailure(ctx, msg.ChatID, msg.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(msgs), nil
+}
+
+// embedMessages computes the embeddings of msgs in a single request
+func (h Controller) embedMessages(ctx context.Context, msgs []repo.Message) ([]repo.MessageEmbedding, error) {
+	input := make([]string, len(msgs))
+	for i, msg := range msgs {
+		input[i] = formatMessageForGPT(msg)
+	}
+
+	resp, err := h.OpenAI.Embeddings(&openai.EmbeddingsParams{
+		Context:       ctx,
+		WaitRateLimit: true,
+		Input:         input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(msgs) {
+		return nil, fmt.Errorf("embeddings: want %d, got %d", len(msgs), len(resp.Data))
+	}
+
+	embeddings := make([]repo.MessageEmbedding, len(msgs))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(msgs) || embeddings[d.Index].Vector != nil {
+			return nil, fmt.Errorf("embeddings: unexpected index %d", d.Index)
+		}
+
+		msg := msgs[d.Index]
+		embeddings[d.Index] = repo.MessageEmbedding{
+			ChatID:    msg.ChatID,
+			MessageID: msg.ID,
+			Model:     resp.Model,
+			Vector:    d.Embedding,
+		}
+	}
+
+	return embeddings, nil
+}
+
+// relatedMessages finds old messages similar to the question, along with the
+// thread each one replied to. Messages already in the recent context are skipped.
+func (h Controller) relatedMessages(chatID int64, question string, before time.Time, recent []repo.Message) ([]repo.Message, error) {
+	resp, err := h.OpenAI.Embeddings(&openai.EmbeddingsParams{
+		Input: []string{question},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	similar, err := h.Repo.FindSimilarMessages(context.TODO(), chatID, resp.Data[0].Embedding, before, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int]bool{}
+	for _, msg := range recent {
+		seen[msg.ID] = true
+	}
+
+	related := []repo.Message{}
+	for _, msg := range similar {
+		thread, err := h.Repo.FindMessageThread(context.TODO(), chatID, msg.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range thread {
+			if seen[msg.ID] {
+				continue
+			}
+			seen[msg.ID] = true
+			related = append(related, msg)
+		}
+	}
+
+	sort.Slice(related, func(i, j int) bool {
+		return related[i].Date.Before(related[j].Date)
+	})
+
+	return related, nil
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+)
+
+// Help lists the commands, or explains the given one
+func (h Controller) Help(s bot.Service, u bot.Update, args bh.Args) error {
+	if name := args.Get("comando"); name != "" {
+		cmd, ok := h.Commands.Find(name)
+		if !ok || cmd.Hidden {
+			return bh.Reply{
+				Text: "comando não encontrado. veja a lista com /help",
+			}
+		}
+		return bh.Reply{
+			Text: commandHelp(cmd),
+		}
+	}
+
+	txt := "comandos:\n"
+	for _, cmd := range h.Commands.Commands() {
+		if cmd.Permission == bh.PermissionGod {
+			continue
+		}
+		txt += "/" + cmd.Name + " - " + cmd.Description
+		if cmd.Permission == bh.PermissionAdmin {
+			txt += " (admin)"
+		}
+		txt += "\n"
+	}
+	txt += "\nmais detalhes com /help <comando>"
+
+	return bh.Reply{
+		Text: txt,
+	}
+}
+
+func commandHelp(cmd bh.CommandSpec) string {
+	txt := cmd.Usage() + "\n" + cmd.Description + "\n"
+
+	if len(cmd.Args) > 0 {
+		txt += "\nargumentos:\n"
+		for _, arg := range cmd.Args {
+			txt += "- " + arg.Name
+			if arg.Optional {
+				txt += " (opcional)"
+			}
+			txt += ": " + arg.Description + "\n"
+		}
+	}
+
+	switch cmd.Permission {
+	case bh.PermissionAdmin:
+		txt += "\nsó admins podem usar"
+	case bh.PermissionGod:
+		txt += "\nsó o dono do bot pode usar"
+	}
+
+	return strings.TrimSpace(txt)
+}
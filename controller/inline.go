@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+const (
+	// inline queries starting with it are questions to ChatGPT instead of audio searches
+	inlineGPTPrefix = "?"
+	// max results telegram accepts per answer
+	inlinePageSize = 50
+	// how long telegram caches the ChatGPT answers, in seconds
+	inlineCacheTime = 300
+	// sent with /start when the user taps the button shown by inline mode
+	inlineStartParameter = "inline"
+	inlineHelp           = "para mandar áudios em qualquer conversa com @bot <termo>, " +
+		"use /inline no grupo cujos áudios você quer usar. " +
+		"para perguntar ao ChatGPT, use @bot ? <pergunta>"
+)
+
+// InlineQuery searches the audio library of the chat the user chose with
+// /inline. Queries starting with "?" are sent to ChatGPT.
+func (h Controller) InlineQuery(s bot.Service, q *bot.InlineQuery) error {
+	query := strings.TrimSpace(q.Query)
+	if strings.HasPrefix(query, inlineGPTPrefix) {
+		question := strings.TrimSpace(strings.TrimPrefix(query, inlineGPTPrefix))
+		if question == "" {
+			return nil
+		}
+		return h.inlineGPT(s, q, question)
+	}
+
+	return h.inlineAudios(s, q, query)
+}
+
+// InlineChat makes the chat's audio library the one searched by the user in inline mode
+func (h Controller) InlineChat(s bot.Service, u bot.Update, args bh.Args) error {
+	if u.Message.Chat.Type == "private" {
+		return bh.Reply{
+			Text: inlineHelp,
+		}
+	}
+
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureAudio)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	err := h.Repo.SaveInlineChat(context.TODO(), u.Message.From.ID, u.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	return bh.Reply{
+		Text: fmt.Sprintf("agora o modo inline (@%s <termo>) usa os áudios desse grupo", h.BotInfo.Username),
+	}
+}
+
+func (h Controller) inlineAudios(s bot.Service, q *bot.InlineQuery, query string) error {
+	chatID, err := h.Repo.FindInlineChat(context.TODO(), q.From.ID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return h.inlineHint(s, q, "escolha o grupo dos áudios com /inline")
+	}
+	if err != nil {
+		return err
+	}
+
+	enables, _ := h.Repo.ChatEnables(context.TODO(), chatID, repo.FeatureAudio)
+	if !enables {
+		return h.inlineHint(s, q, "os áudios estão desativados nesse grupo")
+	}
+
+	// the user may have left the group after choosing it with /inline
+	member, err := h.Members.IsMember(s, chatID, q.From.ID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return h.inlineHint(s, q, "você não está nesse grupo. escolha outro com /inline")
+	}
+
+	offset, _ := strconv.Atoi(q.Offset)
+
+	// one extra voice tells if there is a next page
+	voices, err := h.Repo.SearchVoices(context.TODO(), chatID, query, inlinePageSize+1, offset)
+	if err != nil {
+		return err
+	}
+
+	nextOffset := ""
+	if len(voices) > inlinePageSize {
+		voices = voices[:inlinePageSize]
+		nextOffset = strconv.Itoa(offset + inlinePageSize)
+	}
+
+	results := []bot.InlineQueryResult{}
+	for _, v := range voices {
+		title := v.Name
+		if v.Label != "" {
+			title += " · " + util.Truncate(v.Label, 60)
+		}
+		results = append(results, bot.InlineQueryResult{
+			Type:        "voice",
+			ID:          strconv.FormatInt(v.ID, 10),
+			Title:       title,
+			VoiceFileID: v.FileID,
+		})
+	}
+
+	return s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
+		InlineQueryID: q.ID,
+		Results:       results,
+		// results depend on the chat chosen by the user
+		IsPersonal: true,
+		NextOffset: nextOffset,
+	})
+}
+
+// inlineHint answers with no results and a button explaining how to use inline mode
+func (h Controller) inlineHint(s bot.Service, q *bot.InlineQuery, text string) error {
+	return s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
+		InlineQueryID:     q.ID,
+		Results:           []bot.InlineQueryResult{},
+		IsPersonal:        true,
+		SwitchPMText:      text,
+		SwitchPMParameter: inlineStartParameter,
+	})
+}
+
+// inlineGPT answers the inline query with the ChatGPT answer to the question.
+// Only the last query the user typed is sent to ChatGPT.
+func (h Controller) inlineGPT(s bot.Service, q *bot.InlineQuery, question string) error {
+	answer, err := h.Inline.Do(q.From.ID, question, func(ctx context.Context) (string, error) {
+		resp, err := h.OpenAI.Completion(&openai.CompletionParams{
+			Context:       ctx,
+			WaitRateLimit: true,
+			Messages: []openai.Message{
+				{
+					Content: question,
+				},
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("openai: completion returned no choices")
+		}
+		return resp.Choices[0].Message.Content, nil
+	})
+
+	// the user kept typing
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{
+			Text: "erro ao perguntar ao ChatGPT",
+		}
+	}
+
+	return s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
+		InlineQueryID: q.ID,
+		Results: []bot.InlineQueryResult{
+			{
+				Type:  "article",
+				ID:    fmt.Sprintf("%016X", rand.Int63()),
+				Title: util.Truncate(answer, 100),
+				InputMessageContent: &bot.InputMessageContent{
+					MessageText: answer,
+				},
+			},
+		},
+		CacheTime:  inlineCacheTime,
+		IsPersonal: true,
+	})
+}
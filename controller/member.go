@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// ChatMember keeps track of membership changes. The bot joining a chat saves
+// it, and changes of other members update the membership cache right away.
+func (h Controller) ChatMember(s bot.Service, m *bot.ChatMemberUpdated) error {
+	user := m.NewChatMember.User
+	if user == nil {
+		return nil
+	}
+	member := isMemberStatus(m.NewChatMember.Status)
+
+	if user.ID != h.BotInfo.ID {
+		h.Members.Set(m.Chat.ID, user.ID, member)
+		return nil
+	}
+
+	if !member {
+		log.Printf("removed from chat %d (%s)", m.Chat.ID, m.Chat.Name())
+		return nil
+	}
+	return h.Repo.SaveChat(context.TODO(), repo.Chat{
+		ID:    m.Chat.ID,
+		Title: m.Chat.Name(),
+	})
+}
+
+// MemberCache caches getChatMember answers. Inline queries arrive on every
+// keystroke, so asking telegram each time would hit the rate limit.
+type MemberCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mut     *sync.Mutex
+	members map[memberKey]cachedMember
+}
+
+type memberKey struct {
+	chatID int64
+	userID int64
+}
+
+type cachedMember struct {
+	member  bool
+	expires time.Time
+}
+
+func NewMemberCache(ttl time.Duration) *MemberCache {
+	return &MemberCache{
+		ttl:     ttl,
+		now:     time.Now,
+		mut:     new(sync.Mutex),
+		members: map[memberKey]cachedMember{},
+	}
+}
+
+// IsMember tells if the user is still in the chat. A nil cache always asks telegram.
+func (c *MemberCache) IsMember(s bot.Service, chatID int64, userID int64) (bool, error) {
+	if c == nil {
+		return isMember(s, chatID, userID)
+	}
+
+	key := memberKey{chatID: chatID, userID: userID}
+
+	c.mut.Lock()
+	cached, ok := c.members[key]
+	c.mut.Unlock()
+	if ok && c.now().Before(cached.expires) {
+		return cached.member, nil
+	}
+
+	member, err := isMember(s, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.evictExpired()
+	c.members[key] = cachedMember{
+		member:  member,
+		expires: c.now().Add(c.ttl),
+	}
+	return member, nil
+}
+
+// Set caches the membership of the user, as told by a chat_member update
+func (c *MemberCache) Set(chatID int64, userID int64, member bool) {
+	if c == nil {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.evictExpired()
+	c.members[memberKey{chatID: chatID, userID: userID}] = cachedMember{
+		member:  member,
+		expires: c.now().Add(c.ttl),
+	}
+}
+
+// evictExpired must be called with the lock held
+func (c *MemberCache) evictExpired() {
+	now := c.now()
+	for k, v := range c.members {
+		if !now.Before(v.expires) {
+			delete(c.members, k)
+		}
+	}
+}
+
+func isMember(s bot.Service, chatID int64, userID int64) (bool, error) {
+	member, err := s.GetChatMember(bot.GetChatMemberParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return isMemberStatus(member.Status), nil
+}
+
+func isMemberStatus(status string) bool {
+	return status != "left" && status != "kicked"
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/bot/botrecord"
+)
+
+func TestMemberCache(t *testing.T) {
+	out := &bytes.Buffer{}
+	s := botrecord.NewFakeService(out, bot.User{ID: 1})
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	c := NewMemberCache(time.Minute)
+	c.now = clock.Now
+
+	calls := func() int {
+		return strings.Count(out.String(), "getChatMember")
+	}
+
+	member, err := c.IsMember(s, 10, 100)
+	if err != nil || !member {
+		t.Fatalf("member - want: %v, got: %v (%v)", true, member, err)
+	}
+
+	s.MemberStatus = "left"
+	member, _ = c.IsMember(s, 10, 100)
+	if !member || calls() != 1 {
+		t.Fatalf("cached - want: %v %d, got: %v %d", true, 1, member, calls())
+	}
+
+	member, _ = c.IsMember(s, 20, 100)
+	if member || calls() != 2 {
+		t.Fatalf("other chat - want: %v %d, got: %v %d", false, 2, member, calls())
+	}
+
+	clock.Advance(time.Minute)
+	member, _ = c.IsMember(s, 10, 100)
+	if member || calls() != 3 {
+		t.Fatalf("expired - want: %v %d, got: %v %d", false, 3, member, calls())
+	}
+
+	s.MemberStatus = "kicked"
+	clock.Advance(time.Minute)
+	member, _ = c.IsMember(s, 10, 100)
+	if member {
+		t.Fatalf("kicked - want: %v, got: %v", false, member)
+	}
+}
+
+func TestMemberCacheSet(t *testing.T) {
+	out := &bytes.Buffer{}
+	s := botrecord.NewFakeService(out, bot.User{ID: 1})
+	c := NewMemberCache(time.Minute)
+
+	c.Set(10, 100, false)
+	member, err := c.IsMember(s, 10, 100)
+	if err != nil || member {
+		t.Fatalf("member - want: %v, got: %v (%v)", false, member, err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("calls - want: none, got: %s", out)
+	}
+
+	var nilCache *MemberCache
+	nilCache.Set(10, 100, false)
+	member, _ = nilCache.IsMember(s, 10, 100)
+	if !member {
+		t.Fatalf("nil cache - want: %v, got: %v", true, member)
+	}
+}
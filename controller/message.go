@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// EditedMessage keeps saved messages up to date with their edits
+func (h Controller) EditedMessage(s bot.Service, u bot.Update) error {
+	msg := u.EditedMessage
+
+	enables, _ := h.Repo.ChatEnables(context.TODO(), msg.Chat.ID, repo.FeatureCAsk)
+	if !enables {
+		return nil
+	}
+
+	date := time.Unix(msg.EditDate, 0)
+	text := strings.TrimSpace(msg.Text)
+	caption := strings.TrimSpace(msg.Caption)
+	err := h.Repo.EditMessage(context.TODO(), msg.Chat.ID, msg.MessageID, text, caption, date)
+	if errors.Is(err, repo.ErrNotFound) {
+		// message was never saved (e.g. a command). ignore
+		return nil
+	}
+	return err
+}
+
+// saveMessage saves the message for /cask, if enabled in the chat.
+// Voice messages are transcribed in the background.
+func (h Controller) saveMessage(s bot.Service, msg *bot.Message) error {
+	if msg.From == nil {
+		return nil
+	}
+
+	enables, _ := h.Repo.ChatEnables(context.TODO(), msg.Chat.ID, repo.FeatureCAsk)
+	if !enables {
+		return nil
+	}
+
+	name := username(msg.From)
+	id := msg.From.ID
+	origin := ""
+
+	if msg.FowardFrom != nil {
+		name = username(msg.FowardFrom) + "(forward)"
+		id = msg.FowardFrom.ID
+		origin = username(msg.FowardFrom)
+	}
+
+	if msg.ForwardSenderName != "" {
+		id = 0
+		name = sanitizeUsername(msg.ForwardSenderName)
+		origin = name
+	}
+
+	if msg.ForwardFromChat != nil {
+		origin = msg.ForwardFromChat.Name()
+	}
+
+	replyID := 0
+	if msg.ReplyToMessage != nil {
+		replyID = msg.ReplyToMessage.MessageID
+	}
+
+	m := repo.Message{
+		ID:               msg.MessageID,
+		ReplyToMessageID: replyID,
+		ChatID:           msg.Chat.ID,
+		Text:             strings.TrimSpace(msg.Text),
+		Caption:          strings.TrimSpace(msg.Caption),
+		Date:             time.Unix(msg.Date, 0),
+		UserID:           id,
+		UserName:         name,
+		ContentType:      repo.ContentTypeText,
+		ForwardOrigin:    origin,
+	}
+
+	switch {
+	case len(msg.Photo) > 0:
+		// sizes are sorted, the last one is the original
+		m.ContentType = repo.ContentTypePhoto
+		m.FileID = msg.Photo[len(msg.Photo)-1].FileID
+	case msg.Sticker != nil:
+		m.ContentType = repo.ContentTypeSticker
+		m.FileID = msg.Sticker.FileID
+		m.StickerEmoji = msg.Sticker.Emoji
+	case msg.Voice != nil:
+		m.ContentType = repo.ContentTypeVoice
+		m.FileID = msg.Voice.FileID
+	case msg.Document != nil:
+		m.ContentType = repo.ContentTypeDocument
+		m.FileID = msg.Document.FileID
+	}
+
+	if m.ContentType == repo.ContentTypeText && m.Text == "" {
+		// nothing worth saving, e.g. someone joined the chat
+		return nil
+	}
+
+	err := h.Repo.SaveMessage(context.TODO(), m)
+	if err != nil {
+		return err
+	}
+
+	// saved voices are transcribed whenever /cask is enabled, so /cask and
+	// /busca can use what was said
+	if msg.Voice != nil {
+		h.transcribeInBackground(s, msg)
+	}
+	return nil
+}
+
+// Forget deletes the replied message from the database. Admins can delete any
+// message, and users their own. With "tudo", admins delete the replies too.
+func (h Controller) Forget(s bot.Service, u bot.Update, args bh.Args) error {
+	target := args.Reply
+
+	var withReplies bool
+	switch strings.ToLower(args.Get("tudo")) {
+	case "":
+	case "tudo":
+		withReplies = true
+	default:
+		return bh.Reply{
+			Text: "argumento inválido\nuso: /esquecer [tudo]",
+		}
+	}
+
+	isAdmin, err := h.isAdmin(s, u)
+	if err != nil {
+		return err
+	}
+	isAuthor := target.From != nil && target.From.ID == u.Message.From.ID
+	if !isAdmin && !isAuthor {
+		return bh.Reply{
+			Text: "você não tem permissão para isso",
+		}
+	}
+
+	if withReplies && !isAdmin {
+		return bh.Reply{
+			Text: "só admins podem esquecer as respostas",
+		}
+	}
+
+	n, err := h.Repo.DeleteMessage(context.TODO(), u.Message.Chat.ID, target.MessageID, withReplies)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return bh.Reply{
+			Text: "essa mensagem não está salva",
+		}
+	}
+	if n == 1 {
+		return bh.Reply{
+			Text: "mensagem esquecida",
+		}
+	}
+	return bh.Reply{
+		Text: fmt.Sprintf("%d mensagens esquecidas", n),
+	}
+}
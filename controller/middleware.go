@@ -12,11 +12,12 @@ import (
 func (h Controller) EnsureStarted() bh.Middleware {
 	return func(next bh.HandlerFunc) bh.HandlerFunc {
 		return func(s bot.Service, u bot.Update) error {
-			if u.Message.Text == "/start" {
+			chat := bh.UpdateChat(u)
+			if chat == nil || bh.Command("start")(s, u) {
 				return next(s, u)
 			}
 
-			_, err := h.Repo.FindChat(context.TODO(), u.Message.Chat.ID)
+			_, err := h.Repo.FindChat(context.TODO(), chat.ID)
 			if errors.Is(err, repo.ErrNotFound) {
 				// chat not /start'ed. ignore
 				return nil
@@ -30,7 +31,7 @@ func (h Controller) EnsureStarted() bh.Middleware {
 func (h Controller) IgnoreForwardedCommand() bh.Middleware {
 	return func(next bh.HandlerFunc) bh.HandlerFunc {
 		return func(s bot.Service, u bot.Update) error {
-			if u.Message.ForwardSenderName != "" || u.Message.FowardFrom != nil {
+			if u.Message != nil && (u.Message.ForwardSenderName != "" || u.Message.FowardFrom != nil) {
 				return nil
 			}
 			return next(s, u)
@@ -40,7 +41,8 @@ func (h Controller) IgnoreForwardedCommand() bh.Middleware {
 
 func (h Controller) RequireGod(next bh.HandlerFunc) bh.HandlerFunc {
 	return func(s bot.Service, u bot.Update) error {
-		if u.Message.Chat.Type == "private" && u.Message.From.ID == h.Config.GodID {
+		chat, from := bh.UpdateChat(u), bh.UpdateFrom(u)
+		if chat != nil && from != nil && chat.Type == "private" && h.Config.IsGod(from.ID) {
 			return next(s, u)
 		}
 
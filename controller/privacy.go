@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+)
+
+// Privacy lets users opt out of having their messages saved in the chat.
+// "/privacidade on" opts out and deletes what was saved, "/privacidade off" opts back in.
+func (h Controller) Privacy(s bot.Service, u bot.Update, args bh.Args) error {
+	chatID := u.Message.Chat.ID
+	userID := u.Message.From.ID
+
+	switch strings.ToLower(args.Get("on|off")) {
+	case "on":
+		err := h.Repo.SetMessageOptOut(context.TODO(), chatID, userID, true)
+		if err != nil {
+			return err
+		}
+
+		n, err := h.Repo.DeleteUserMessages(context.TODO(), chatID, userID)
+		if err != nil {
+			return err
+		}
+
+		return bh.Reply{
+			Text: fmt.Sprintf("privacidade ativada. suas mensagens não serão mais salvas nesse chat (%d mensagens apagadas)", n),
+		}
+
+	case "off":
+		err := h.Repo.SetMessageOptOut(context.TODO(), chatID, userID, false)
+		if err != nil {
+			return err
+		}
+
+		return bh.Reply{
+			Text: "privacidade desativada. suas mensagens serão salvas nesse chat quando o /cask estiver ativado",
+		}
+
+	default:
+		optedOut, err := h.optedOutUsers(chatID)
+		if err != nil {
+			return err
+		}
+
+		status := "desativada"
+		if optedOut[userID] {
+			status = "ativada"
+		}
+
+		return bh.Reply{
+			Text: fmt.Sprintf("sua privacidade está %s nesse chat\nuso: /privacidade on|off", status),
+		}
+	}
+}
+
+// MyData sends to the user, in private, everything stored about them
+func (h Controller) MyData(s bot.Service, u bot.Update) error {
+	data, err := h.Repo.FindUserData(context.TODO(), u.Message.From.ID)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = s.SendDocument(bot.SendDocumentParams{
+		ChatID:   u.Message.From.ID,
+		FileName: fmt.Sprintf("meusdados-%d.json", u.Message.From.ID),
+		Content:  b,
+		Caption:  "tudo que está salvo sobre você",
+	})
+
+	// bots can't start private chats
+	var botErr bot.BotError
+	if errors.As(err, &botErr) && botErr.Status == http.StatusForbidden {
+		return bh.Reply{
+			Text: fmt.Sprintf("me manda uma mensagem no privado (@%s) e tenta de novo", s.Username()),
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if u.Message.Chat.Type != "private" {
+		return bh.Reply{
+			Text: "te mandei no privado",
+		}
+	}
+	return nil
+}
+
+func (h Controller) optedOutUsers(chatID int64) (map[int64]bool, error) {
+	userIDs, err := h.Repo.FindMessageOptOuts(context.TODO(), chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	optedOut := map[int64]bool{}
+	for _, id := range userIDs {
+		optedOut[id] = true
+	}
+	return optedOut, nil
+}
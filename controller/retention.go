@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+const retentionUsage = "uso:\n" +
+	"/retencao - mostra a política atual\n" +
+	"/retencao dias <N> - apaga mensagens com mais de N dias\n" +
+	"/retencao mensagens <N> - mantém só as últimas N mensagens\n" +
+	"/retencao off - mantém todas as mensagens"
+
+// Retention shows and changes how long messages are kept in the chat
+func (h Controller) Retention(s bot.Service, u bot.Update, args bh.Args) error {
+	mode := args.Get("modo")
+	value := args.Get("N")
+
+	p, err := h.Repo.FindRetentionPolicy(context.TODO(), u.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mode == "":
+		return bh.Reply{
+			Text: describeRetention(p.MaxAge, p.MaxRows),
+		}
+
+	case mode == "off" && value == "":
+		p.MaxAge = 0
+		p.MaxRows = 0
+
+	case value != "":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return bh.Reply{
+				Text: retentionUsage,
+			}
+		}
+
+		switch mode {
+		case "dias":
+			p.MaxAge = time.Duration(n) * 24 * time.Hour
+		case "mensagens":
+			p.MaxRows = n
+		default:
+			return bh.Reply{
+				Text: retentionUsage,
+			}
+		}
+
+	default:
+		return bh.Reply{
+			Text: retentionUsage,
+		}
+	}
+
+	err = h.Repo.SaveRetentionPolicy(context.TODO(), *p)
+	if err != nil {
+		return err
+	}
+
+	return bh.Reply{
+		Text: describeRetention(p.MaxAge, p.MaxRows),
+	}
+}
+
+func describeRetention(maxAge time.Duration, maxRows int) string {
+	if maxAge == 0 && maxRows == 0 {
+		return "todas as mensagens são mantidas"
+	}
+
+	limits := []string{}
+	if maxAge > 0 {
+		limits = append(limits, "por "+util.RelativeDuration(maxAge))
+	}
+	if maxRows > 0 {
+		limits = append(limits, fmt.Sprintf("até as últimas %d", maxRows))
+	}
+	return "mensagens são mantidas " + strings.Join(limits, " e ")
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+const searchPageSize = 5
+
+func (h Controller) Search(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureCAsk)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	terms := args.Get("termos")
+
+	txt, markup, err := h.searchPage(u.Message.Chat.ID, terms, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.SendMessage(bot.SendMessageParams{
+		ChatID:                   u.Message.Chat.ID,
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		Text:                     txt,
+		ParseMode:                "HTML",
+		ReplyMarkup:              markup,
+	})
+	return err
+}
+
+// SearchPage handles the pagination buttons of /busca.
+// The search terms are taken from the /busca message the results replied to.
+func (h Controller) SearchPage(s bot.Service, cq *bot.CallbackQuery) error {
+	if cq.Message == nil || cq.Message.ReplyToMessage == nil {
+		return s.AnswerCallbackQuery(bot.AnswerCallbackQueryParams{
+			CallbackQueryID: cq.ID,
+			Text:            "não achei a busca original",
+		})
+	}
+
+	page, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "busca:"))
+	if err != nil || page < 0 {
+		return bh.Reply{
+			Text: "página inválida",
+		}
+	}
+
+	terms := searchTerms(s, cq.Message.ReplyToMessage)
+	txt, markup, err := h.searchPage(cq.Message.Chat.ID, terms, page)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.EditMessageText(bot.EditMessageTextParams{
+		ChatID:      cq.Message.Chat.ID,
+		MessageID:   cq.Message.MessageID,
+		Text:        txt,
+		ParseMode:   "HTML",
+		ReplyMarkup: markup,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.AnswerCallbackQuery(bot.AnswerCallbackQueryParams{
+		CallbackQueryID: cq.ID,
+	})
+}
+
+func (h Controller) searchPage(chatID int64, terms string, page int) (string, *bot.InlineKeyboardMarkup, error) {
+	// one extra result tells if there is a next page
+	results, err := h.Repo.SearchMessages(context.TODO(), chatID, terms, searchPageSize+1, page*searchPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	hasNext := len(results) > searchPageSize
+	if hasNext {
+		results = results[:searchPageSize]
+	}
+
+	if len(results) == 0 {
+		return fmt.Sprintf("nenhum resultado para <b>%s</b>", html.EscapeString(terms)), nil, nil
+	}
+
+	txt := fmt.Sprintf("resultados para <b>%s</b> (página %d)\n", html.EscapeString(terms), page+1)
+	for i, res := range results {
+		txt += fmt.Sprintf(
+			"\n%d. <b>%s</b> · %s\n%s\n",
+			page*searchPageSize+i+1,
+			html.EscapeString(res.UserName),
+			res.Date.In(time.Local).Format("02/01/2006 15:04"),
+			highlightSnippet(res.Snippet),
+		)
+		if link := messageLink(res.ChatID, res.ID); link != "" {
+			txt += link + "\n"
+		}
+	}
+
+	buttons := []bot.InlineKeyboardButton{}
+	if page > 0 {
+		buttons = append(buttons, bot.InlineKeyboardButton{
+			Text:         "◀️",
+			CallbackData: fmt.Sprintf("busca:%d", page-1),
+		})
+	}
+	if hasNext {
+		buttons = append(buttons, bot.InlineKeyboardButton{
+			Text:         "▶️",
+			CallbackData: fmt.Sprintf("busca:%d", page+1),
+		})
+	}
+
+	var markup *bot.InlineKeyboardMarkup
+	if len(buttons) > 0 {
+		markup = &bot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]bot.InlineKeyboardButton{buttons},
+		}
+	}
+
+	return txt, markup, nil
+}
+
+// searchTerms returns the terms of the /busca message
+func searchTerms(s bot.Service, msg *bot.Message) string {
+	args, _ := bh.ParseArgs(bh.CommandSpec{
+		Args: []bh.Arg{{Name: "termos", Text: true, Optional: true}},
+	}, msg, s.Username())
+	return args.Get("termos")
+}
+
+// highlightSnippet escapes the snippet as HTML and makes the matched terms bold
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, repo.SnippetMatchStart, "<b>")
+	snippet = strings.ReplaceAll(snippet, repo.SnippetMatchEnd, "</b>")
+	return snippet
+}
+
+// messageLink returns the t.me link to the message. Only supergroups have
+// message links, so it returns "" for other chats.
+func messageLink(chatID int64, msgID int) string {
+	id := strconv.FormatInt(chatID, 10)
+	if !strings.HasPrefix(id, "-100") {
+		return ""
+	}
+	return fmt.Sprintf("t.me/c/%s/%d", strings.TrimPrefix(id, "-100"), msgID)
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/sed"
+)
+
+// runSed applies the sed script of the message to the message it replies to
+func (h Controller) runSed(s bot.Service, u bot.Update) error {
+	replied := u.Message.ReplyToMessage
+	text := replied.Text
+	if text == "" {
+		text = replied.Caption
+	}
+	if text == "" {
+		return nil
+	}
+
+	out, err := sed.Run(context.TODO(), u.Message.Text, text, sed.DefaultLimits)
+	var sedErr *sed.Error
+	if errors.As(err, &sedErr) {
+		return bh.Reply{
+			Text: "sed: " + sedErr.Error(),
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		out = "(vazio)"
+	}
+
+	_, err = s.SendMessage(bot.SendMessageParams{
+		ChatID:                   u.Message.Chat.ID,
+		ReplyToMessageID:         replied.MessageID,
+		AllowSendingWithoutReply: true,
+		Text:                     out,
+	})
+	return err
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+const (
+	// how many characters of messages go in each summary request
+	summaryChunkLen = 6000
+	// long periods are summarized in parts, and then the parts are summarized together
+	summaryMaxChunks = 8
+)
+
+func (h Controller) Summarize(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureCAsk)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	end := time.Unix(u.Message.Date, 0)
+	start := time.Time{}
+
+	if u.Message.ReplyToMessage != nil {
+		start = time.Unix(u.Message.ReplyToMessage.Date, 0)
+	} else {
+		var err error
+		start, err = summaryStart(args.Get("período"), end)
+		if err != nil {
+			return bh.Reply{
+				Text: err.Error(),
+			}
+		}
+	}
+
+	msgs, err := h.Repo.FindMessagesBetweenDates(context.TODO(), u.Message.Chat.ID, start, end)
+	if err != nil {
+		return err
+	}
+
+	optedOut, err := h.optedOutUsers(u.Message.Chat.ID)
+	if err != nil {
+		return err
+	}
+
+	filtered := []repo.Message{}
+	for _, msg := range msgs {
+		if !optedOut[msg.UserID] {
+			filtered = append(filtered, msg)
+		}
+	}
+	msgs = filtered
+
+	if len(msgs) == 0 {
+		return bh.Reply{
+			Text: "nenhuma mensagem salva nesse período",
+		}
+	}
+
+	msg, err := s.SendMessage(bot.SendMessageParams{
+		ChatID:           u.Message.Chat.ID,
+		ReplyToMessageID: u.Message.MessageID,
+		Text:             fmt.Sprintf("Resumindo %d mensagens...", len(msgs)),
+	})
+	if err != nil {
+		return err
+	}
+
+	summary, err := h.summarize(u.Message.Chat.Name(), msgs)
+
+	var rateErr openai.ErrRateLimit
+	if errors.As(err, &rateErr) {
+		go h.rateLimitCountdown(s, u.Message.Chat.ID, msg.MessageID)
+		return nil
+	}
+
+	var reply bh.Reply
+	if errors.As(err, &reply) {
+		_, err = s.EditMessageText(bot.EditMessageTextParams{
+			ChatID:    u.Message.Chat.ID,
+			MessageID: msg.MessageID,
+			Text:      reply.Text,
+		})
+		return err
+	}
+
+	if err != nil {
+		_, _ = s.EditMessageText(bot.EditMessageTextParams{
+			ChatID:    u.Message.Chat.ID,
+			MessageID: msg.MessageID,
+			Text:      "vish deu ruim",
+		})
+		return err
+	}
+
+	_, err = s.EditMessageText(bot.EditMessageTextParams{
+		ChatID:    u.Message.Chat.ID,
+		MessageID: msg.MessageID,
+		Text: fmt.Sprintf(
+			"resumo de %d mensagens desde %s\n\n%s",
+			len(msgs),
+			start.Format("02/01 15:04"),
+			summary,
+		),
+	})
+	return err
+}
+
+// summarize summarizes the messages in a single request if they are short enough.
+// Otherwise each chunk of messages is summarized separately (map), and the partial
+// summaries are then summarized together (reduce).
+func (h Controller) summarize(title string, msgs []repo.Message) (string, error) {
+	lines := []string{}
+	for _, msg := range msgs {
+		lines = append(lines, formatMessageForGPT(msg))
+	}
+
+	chunks := chunkLines(lines, summaryChunkLen)
+	if len(chunks) > summaryMaxChunks {
+		return "", bh.Reply{
+			Text: "mensagem demais pra resumir, tenta um período menor",
+		}
+	}
+
+	content := strings.Join(lines, "\n")
+
+	if len(chunks) > 1 {
+		parts := []string{}
+		for i, chunk := range chunks {
+			part, err := h.completionText(fmt.Sprintf(
+				"Abaixo está a parte %d de %d das mensagens do chat %s, no formato '<usuario>: <texto>'. "+
+					"Resuma os assuntos discutidos em tópicos curtos, mantendo quem disse o quê.\n\n%s",
+				i+1,
+				len(chunks),
+				title,
+				strings.Join(chunk, "\n"),
+			))
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		content = strings.Join(parts, "\n\n")
+	}
+
+	return h.completionText(fmt.Sprintf(
+		"Abaixo estão as mensagens (ou resumos parciais das mensagens) do chat %s. "+
+			"Escreva um resumo curto dos assuntos discutidos e, em seguida, uma seção 'destaques' "+
+			"com uma linha para cada participante dizendo o que ele trouxe de mais relevante. "+
+			"Participantes (número de mensagens): %s\n\n%s",
+		title,
+		summaryParticipants(msgs),
+		content,
+	))
+}
+
+func (h Controller) completionText(prompt string) (string, error) {
+	resp, err := h.OpenAI.Completion(&openai.CompletionParams{
+		WaitRateLimit: true,
+		Temperature:   0.3,
+		Messages: []openai.Message{
+			{
+				Content: prompt,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("openai: completion returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// summaryParticipants lists who sent the messages, most active first
+func summaryParticipants(msgs []repo.Message) string {
+	counts := map[string]int{}
+	for _, msg := range msgs {
+		counts[msg.UserName]++
+	}
+
+	names := []string{}
+	for name := range counts {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	participants := []string{}
+	for _, name := range names {
+		participants = append(participants, fmt.Sprintf("%s (%d)", name, counts[name]))
+	}
+	return strings.Join(participants, ", ")
+}
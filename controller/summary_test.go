@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestSummaryParticipants(t *testing.T) {
+	msg := func(name string) repo.Message {
+		return repo.Message{UserName: name}
+	}
+
+	tests := []struct {
+		name string
+		msgs []repo.Message
+		want string
+	}{
+		{"no messages", nil, ""},
+		{"one", []repo.Message{msg("Ana")}, "Ana (1)"},
+		{"most active first", []repo.Message{msg("Bia"), msg("Ana"), msg("Ana")}, "Ana (2), Bia (1)"},
+		{"ties by name", []repo.Message{msg("Caio"), msg("Bia"), msg("Caio"), msg("Bia")}, "Bia (2), Caio (2)"},
+		{"without name", []repo.Message{msg(""), msg(""), msg("Ana")}, "Ana (1)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := summaryParticipants(test.msgs)
+			if got != test.want {
+				t.Fatalf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
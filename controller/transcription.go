@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// longer audios are not transcribed, to keep the costs down
+const maxTranscriptionSeconds = 10 * 60
+
+// TranscriptionQueue holds the voices saved for /cask until a worker started by
+// RunTranscriptions transcribes them. Adding to a full queue waits for room.
+type TranscriptionQueue struct {
+	jobs chan transcriptionJob
+}
+
+type transcriptionJob struct {
+	s   bot.Service
+	msg *bot.Message
+}
+
+func NewTranscriptionQueue(size int) *TranscriptionQueue {
+	return &TranscriptionQueue{
+		jobs: make(chan transcriptionJob, size),
+	}
+}
+
+// RunTranscriptions transcribes the queued voices, workers at a time, until the
+// context is done
+func (h Controller) RunTranscriptions(ctx context.Context, workers int) {
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-h.Transcriptions.jobs:
+					h.transcribeSavedVoice(ctx, job.s, job.msg)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Transcribe replies with the transcription of the replied voice message
+func (h Controller) Transcribe(s bot.Service, u bot.Update, args bh.Args) error {
+	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, repo.FeatureTranscribe)
+	if !enables {
+		return bh.Reply{
+			Text: "comando desativado. um admin pode ativar em /config",
+		}
+	}
+
+	target := args.Reply
+	if target.Voice == nil {
+		return bh.Reply{
+			Text: "responda a uma mensagem de voz",
+		}
+	}
+
+	if target.Voice.Duration > maxTranscriptionSeconds {
+		return bh.Reply{
+			Text: "áudio muito longo",
+		}
+	}
+
+	msg, err := s.SendMessage(bot.SendMessageParams{
+		ChatID:           u.Message.Chat.ID,
+		ReplyToMessageID: target.MessageID,
+		Text:             "Transcrevendo...",
+	})
+	if err != nil {
+		return err
+	}
+
+	txt, err := h.transcribe(context.TODO(), s, target.Voice)
+
+	var rateErr openai.ErrRateLimit
+	if errors.As(err, &rateErr) {
+		go h.rateLimitCountdown(s, u.Message.Chat.ID, msg.MessageID)
+		return nil
+	}
+	if err != nil {
+		_, _ = s.EditMessageText(bot.EditMessageTextParams{
+			ChatID:    u.Message.Chat.ID,
+			MessageID: msg.MessageID,
+			Text:      "vish deu ruim",
+		})
+		return err
+	}
+
+	if txt == "" {
+		txt = "(não entendi nada)"
+	} else {
+		// if the voice was saved for /cask, it may not have been transcribed yet
+		err = h.Repo.SaveTranscription(context.TODO(), u.Message.Chat.ID, target.MessageID, txt)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+
+	_, err = s.EditMessageText(bot.EditMessageTextParams{
+		ChatID:    u.Message.Chat.ID,
+		MessageID: msg.MessageID,
+		Text:      txt,
+	})
+	return err
+}
+
+// transcribeInBackground queues the voice message saved for /cask. Without a
+// queue it is transcribed right away.
+func (h Controller) transcribeInBackground(s bot.Service, msg *bot.Message) {
+	if h.Transcriptions == nil {
+		h.transcribeSavedVoice(context.TODO(), s, msg)
+		return
+	}
+	h.Transcriptions.jobs <- transcriptionJob{s: s, msg: msg}
+}
+
+// transcribeSavedVoice transcribes a voice message saved for /cask, so /cask
+// and /busca can use what was said
+func (h Controller) transcribeSavedVoice(ctx context.Context, s bot.Service, msg *bot.Message) {
+	if msg.Voice.Duration > maxTranscriptionSeconds {
+		return
+	}
+
+	// messages from users that opted out are not saved, and their audios must
+	// not be sent to OpenAI either
+	_, err := h.Repo.FindMessage(ctx, msg.Chat.ID, msg.MessageID)
+	if err != nil {
+		return
+	}
+
+	txt, err := h.transcribe(ctx, s, msg.Voice)
+	if err != nil {
+		log.Print("transcribe voice: ", err)
+		return
+	}
+
+	err = h.Repo.SaveTranscription(ctx, msg.Chat.ID, msg.MessageID, txt)
+	if err != nil {
+		log.Print("save transcription: ", err)
+	}
+}
+
+func (h Controller) transcribe(ctx context.Context, s bot.Service, voice *bot.Voice) (string, error) {
+	f, err := s.GetFile(bot.GetFileParams{
+		FileID: voice.FileID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	audio, err := s.DownloadFile(f.FilePath)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := h.OpenAI.Transcription(&openai.TranscriptionParams{
+		Context:       ctx,
+		WaitRateLimit: true,
+		// telegram voice messages are always ogg/opus
+		FileName: "voice.ogg",
+		Audio:    audio,
+		Language: "pt",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(resp.Text), nil
+}
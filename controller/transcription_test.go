@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestTranscriptionQueueWaitsForRoom(t *testing.T) {
+	h := Controller{Transcriptions: NewTranscriptionQueue(1)}
+
+	// too long to be transcribed, so the workers skip them without the repo
+	voice := func(id int) *bot.Message {
+		return &bot.Message{
+			MessageID: id,
+			Chat:      &bot.Chat{ID: 1},
+			Voice:     &bot.Voice{FileID: "f", Duration: maxTranscriptionSeconds + 1},
+		}
+	}
+
+	h.transcribeInBackground(nil, voice(1))
+
+	queued := make(chan struct{})
+	go func() {
+		h.transcribeInBackground(nil, voice(2))
+		close(queued)
+	}()
+
+	select {
+	case <-queued:
+		t.Fatal("queued a voice with the queue full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.RunTranscriptions(ctx, 2)
+		close(done)
+	}()
+
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("the queue was not drained")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(h.Transcriptions.jobs) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued - want: %d, got: %d", 0, len(h.Transcriptions.jobs))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunTranscriptions didn't stop")
+	}
+}
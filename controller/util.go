@@ -2,14 +2,17 @@ package controller
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/igoracmelo/euperturbot/bot"
 	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
 	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/util"
 )
 
 func (h Controller) callSubs(s bot.Service, u bot.Update, topic string, quiet bool) error {
@@ -78,19 +81,45 @@ func (h Controller) callSubs(s bot.Service, u bot.Update, topic string, quiet bo
 	return err
 }
 
-func prepareMessagesForGPT(msgs []repo.Message) []string {
+// rateLimitCountdown edits the message with the time left until the OpenAI rate
+// limit ends, following the deadline if it gets extended meanwhile
+func (h Controller) rateLimitCountdown(s bot.Service, chatID int64, msgID int) {
+	deadline := h.OpenAI.RateLimitDeadline()
+	for time.Now().Before(deadline) {
+		secs := int(math.Ceil(time.Until(deadline).Seconds()))
+		_, _ = s.EditMessageText(bot.EditMessageTextParams{
+			ChatID:    chatID,
+			MessageID: msgID,
+			Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", secs),
+		})
+		time.Sleep(time.Second)
+		deadline = h.OpenAI.RateLimitDeadline()
+	}
+
+	_, _ = s.EditMessageText(bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: msgID,
+		Text:      "manda de novo ae",
+	})
+}
+
+var (
+	reURL        = regexp.MustCompile(`https?:\/\/\S+`)
+	reMultiSpace = regexp.MustCompile(`\s+`)
+	reLaugh      = regexp.MustCompile(`([kK]{7})[kK]+`)
+)
+
+// prepareMessagesForGPT formats the most recent messages that fit in the prompt,
+// skipping the ones from users that opted out of message logging
+func prepareMessagesForGPT(msgs []repo.Message, optedOut map[int64]bool) []string {
 	msgTxts := []string{}
 	totalLen := 0
 
-	reURL := regexp.MustCompile(`https?:\/\/\S+`)
-	reMultiSpace := regexp.MustCompile(`\s+`)
-	reLaugh := regexp.MustCompile(`([kK]{7})[kK]+`)
-
 	for i := len(msgs) - 1; i >= 0; i-- {
-		txt := msgs[i].UserName + ": " + msgs[i].Text
-		txt = reLaugh.ReplaceAllString(txt, "$1")
-		txt = reURL.ReplaceAllString(txt, "")
-		txt = reMultiSpace.ReplaceAllString(txt, " ")
+		if optedOut[msgs[i].UserID] {
+			continue
+		}
+		txt := formatMessageForGPT(msgs[i])
 		totalLen += len(txt)
 		if totalLen > 2000 {
 			break
@@ -105,6 +134,82 @@ func prepareMessagesForGPT(msgs []repo.Message) []string {
 	return msgTxts
 }
 
+// messages are stored in full, but a single long message shouldn't take the whole prompt
+const maxPromptMessageLen = 500
+
+// formatMessageForGPT formats the message as '<usuario>: <texto>', removing
+// what only wastes tokens
+func formatMessageForGPT(msg repo.Message) string {
+	content := msg.Text
+	switch msg.ContentType {
+	case repo.ContentTypePhoto:
+		content = "[foto] " + msg.Caption
+	case repo.ContentTypeSticker:
+		content = "[sticker " + msg.StickerEmoji + "]"
+	case repo.ContentTypeVoice:
+		content = "[áudio] " + msg.Text
+	case repo.ContentTypeDocument:
+		content = "[arquivo] " + msg.Caption
+	}
+
+	txt := msg.UserName + ": " + util.Truncate(strings.TrimSpace(content), maxPromptMessageLen)
+	txt = reLaugh.ReplaceAllString(txt, "$1")
+	txt = reURL.ReplaceAllString(txt, "")
+	txt = reMultiSpace.ReplaceAllString(txt, " ")
+	return txt
+}
+
+// chunkLines groups lines in chunks of at most maxLen bytes each.
+// A line longer than maxLen gets a chunk of its own.
+func chunkLines(lines []string, maxLen int) [][]string {
+	chunks := [][]string{}
+	chunk := []string{}
+	chunkLen := 0
+
+	for _, line := range lines {
+		if chunkLen+len(line) > maxLen && len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+			chunk = []string{}
+			chunkLen = 0
+		}
+		chunk = append(chunk, line)
+		chunkLen += len(line) + 1
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+var reSummaryHours = regexp.MustCompile(`^(\d+)\s*(h|horas?)$`)
+
+// summaryStart parses the /resumo argument into the start of the period to be summarized
+func summaryStart(arg string, now time.Time) (time.Time, error) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+
+	if arg == "" {
+		return now.Add(-3 * time.Hour), nil
+	}
+
+	if arg == "desde ontem" {
+		y, m, d := now.AddDate(0, 0, -1).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	}
+
+	match := reSummaryHours.FindStringSubmatch(arg)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("uso: /resumo [N horas|desde ontem]")
+	}
+
+	hours, err := strconv.Atoi(match[1])
+	if err != nil || hours < 1 || hours > 72 {
+		return time.Time{}, fmt.Errorf("dá pra resumir de 1 a 72 horas")
+	}
+
+	return now.Add(-time.Duration(hours) * time.Hour), nil
+}
+
 func sanitizeUsername(name string) string {
 	s := ""
 	for _, r := range name {
@@ -143,17 +248,22 @@ func validateTopic(topic string) error {
 }
 
 func (h Controller) isAdmin(s bot.Service, u bot.Update) (bool, error) {
-	if u.Message.Chat.Type == "private" {
+	chat, from := bh.UpdateChat(u), bh.UpdateFrom(u)
+	if chat == nil || from == nil {
+		return false, nil
+	}
+
+	if chat.Type == "private" {
 		return true, nil
 	}
 
-	if u.Message.From.ID == h.Config.GodID {
+	if h.Config.IsGod(from.ID) {
 		return true, nil
 	}
 
 	member, err := s.GetChatMember(bot.GetChatMemberParams{
-		ChatID: u.Message.Chat.ID,
-		UserID: u.Message.From.ID,
+		ChatID: chat.ID,
+		UserID: from.ID,
 	})
 	if err != nil {
 		return false, err
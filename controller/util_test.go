@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestChunkLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		maxLen int
+		want   [][]string
+	}{
+		{"no lines", nil, 5, [][]string{}},
+		{"all fit", []string{"a", "b", "c"}, 10, [][]string{{"a", "b", "c"}}},
+		{"newlines count", []string{"aa", "bb", "cc"}, 5, [][]string{{"aa", "bb"}, {"cc"}}},
+		{"exactly the max", []string{"aaaaa", "b"}, 5, [][]string{{"aaaaa"}, {"b"}}},
+		{"long line alone", []string{"a", "muito longa", "b"}, 5, [][]string{{"a"}, {"muito longa"}, {"b"}}},
+		{"long first line", []string{"muito longa", "a", "b"}, 5, [][]string{{"muito longa"}, {"a", "b"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := chunkLines(test.lines, test.maxLen)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) || len(got) != len(test.want) {
+				t.Fatalf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSummaryStart(t *testing.T) {
+	now := time.Date(2023, 11, 14, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		arg  string
+		want time.Time
+	}{
+		{"", now.Add(-3 * time.Hour)},
+		{"5h", now.Add(-5 * time.Hour)},
+		{"5 horas", now.Add(-5 * time.Hour)},
+		{"1 hora", now.Add(-time.Hour)},
+		{" 2H ", now.Add(-2 * time.Hour)},
+		{"72h", now.Add(-72 * time.Hour)},
+		{"desde ontem", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"Desde Ontem", time.Date(2023, 11, 13, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got, err := summaryStart(test.arg, now)
+		if err != nil {
+			t.Fatalf("%q: %v", test.arg, err)
+		}
+		if !got.Equal(test.want) {
+			t.Fatalf("%q - want: %v, got: %v", test.arg, test.want, got)
+		}
+	}
+
+	for _, arg := range []string{"0h", "73 horas", "abc", "5 dias", "-1h"} {
+		_, err := summaryStart(arg, now)
+		if err == nil {
+			t.Fatalf("%q - want error, got nil", arg)
+		}
+	}
+}
@@ -2,11 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/igoracmelo/euperturbot/bot"
 	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/bot/botrecord"
 	"github.com/igoracmelo/euperturbot/config"
 	"github.com/igoracmelo/euperturbot/controller"
 	"github.com/igoracmelo/euperturbot/openai"
@@ -17,73 +27,353 @@ import (
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	var err error
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
 
-	conf, err := config.Load()
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
+	}
+}
+
+// serve runs the bot
+func serve(args []string) error {
+	_, opts, err := parseArgs("serve", args, 0)
+	if err != nil {
+		return err
 	}
 
-	repo, err := sqliterepo.Open(context.TODO(), "euperturbot.db", "./repo/sqliterepo/migrations")
+	conf, err := opts.loadConfig()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if conf.BotToken == "" {
+		return fmt.Errorf("no bot token. set botToken in the config file or %sBOT_TOKEN", config.EnvPrefix)
+	}
+
+	repo, err := sqliterepo.Open(context.TODO(), conf.DBPath, conf.Migrations)
+	if err != nil {
+		return err
 	}
 	defer repo.Close()
 
-	oai := openai.NewService(conf.OpenAIKey, http.DefaultClient)
+	oai := openai.NewServiceWithOptions(conf.OpenAIKey, http.DefaultClient, openai.Options{
+		BaseURL: conf.OpenAIBaseURL,
+		Model:   conf.OpenAIModel,
+	})
 	bot := bot.NewService(conf.BotToken)
 
 	botInfo, err := bot.GetMe()
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	updates, err := updateSource(conf, bot.GetUpdatesChannel())
+	if err != nil {
+		return err
 	}
+	uh := bh.NewUpdateHandler(bot, updates)
+	uh.Dispatcher = bh.NewDispatcher(100, conf.Workers)
+	uh.LogUpdates = conf.LogLevel == "debug"
 
 	c := controller.Controller{
-		Repo:    repo,
-		OpenAI:  oai,
-		BotInfo: botInfo,
-		Config:  &conf,
+		Repo:           repo,
+		OpenAI:         oai,
+		BotInfo:        botInfo,
+		Config:         &conf,
+		Inline:         controller.NewInlineCoordinator(time.Second, 5*time.Minute),
+		Members:        controller.NewMemberCache(10 * time.Minute),
+		Transcriptions: controller.NewTranscriptionQueue(100),
+		Commands:       uh.Commands,
 	}
 
-	updates := bot.GetUpdatesChannel()
-	uh := bh.NewUpdateHandler(bot, updates)
+	// the background jobs stop on SIGINT or SIGTERM. a backup being written
+	// is cancelled instead of left behind half done.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := sync.WaitGroup{}
+	background := func(fn func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			fn()
+		}()
+	}
+
+	// without a key every batch would fail
+	if conf.OpenAIKey != "" {
+		background(func() { c.IndexEmbeddings(ctx, time.Minute) })
+	} else {
+		log.Print("no OpenAI key, the messages won't be indexed for /cask")
+	}
+	background(func() { c.RunTranscriptions(ctx, 2) })
+	background(func() { sqliterepo.RunPruner(ctx, repo, time.Hour) })
+	if conf.BackupInterval > 0 {
+		background(func() { c.RunBackups(ctx, bot, time.Duration(conf.BackupInterval)) })
+	}
 
+	handle(uh, c)
+
+	err = uh.Commands.Sync(bot)
+	if err != nil {
+		log.Print(err)
+	}
+
+	go logDispatcherStats(uh.Dispatcher)
+
+	done := make(chan struct{})
+	go func() {
+		uh.Start()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	// a second signal kills the bot right away
+	stop()
+	log.Print("shutting down, waiting for the background jobs")
+	jobs.Wait()
+	return nil
+}
+
+// handle registers the middlewares and handlers of the bot
+func handle(uh *bh.UpdateController, c controller.Controller) {
 	uh.Middleware(c.EnsureStarted(), bh.AnyMessage)
 	uh.Middleware(c.IgnoreForwardedCommand(), bh.AnyCommand)
 
-	uh.Handle(bh.Command("start"), c.RequireAdmin(c.Start))
-	uh.Handle(bh.Command("suba"), c.SubToTopic)
-	uh.Handle(bh.Command("desca"), c.UnsubTopic)
-	uh.Handle(bh.Command("pollo"), c.CreatePoll)
-	uh.Handle(bh.Command("bora"), c.CallSubs)
-	uh.Handle(bh.Command("quem"), c.ListSubs)
-	uh.Handle(bh.Command("lista"), c.ListUserTopics)
-	uh.Handle(bh.Command("listudo"), c.ListChatTopics)
+	uh.Guard(bh.PermissionAdmin, c.RequireAdmin)
+	uh.Guard(bh.PermissionGod, c.RequireGod)
+
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "start",
+		Description: "ativa o bot no chat",
+		Args:        []bh.Arg{{Name: "parâmetro", Description: "enviado pelos botões do bot", Optional: true}},
+		Permission:  bh.PermissionAdmin,
+	}, c.Start)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "help",
+		Description: "lista os comandos ou explica um deles",
+		Args:        []bh.Arg{{Name: "comando", Description: "comando a explicar", Optional: true}},
+	}, c.Help)
+
+	// topics
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "suba",
+		Description: "se inscreve em tópicos",
+		Args:        []bh.Arg{{Name: "tópicos", Description: "até 3 tópicos, um por linha", Lines: true}},
+		Chats:       bh.ChatsGroup,
+	}, c.SubToTopic)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "desca",
+		Description: "cancela a inscrição em um tópico",
+		Args:        []bh.Arg{{Name: "tópico", Description: "tópico a sair", Text: true}},
+		Chats:       bh.ChatsGroup,
+	}, c.UnsubTopic)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "pollo",
+		Description: "cria uma enquete para chamar os inscritos no tópico",
+		Args:        []bh.Arg{{Name: "pergunta", Description: "pergunta da enquete", Text: true}},
+		Chats:       bh.ChatsGroup,
+	}, c.CreatePoll)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "bora",
+		Description: "chama os inscritos no tópico",
+		Args:        []bh.Arg{{Name: "tópico", Description: "tópico a chamar", Text: true}},
+		Chats:       bh.ChatsGroup,
+	}, c.CallSubs)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "quem",
+		Description: "lista os inscritos no tópico",
+		Args:        []bh.Arg{{Name: "tópico", Description: "tópico a listar", Text: true}},
+		Chats:       bh.ChatsGroup,
+	}, c.ListSubs)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "lista",
+		Description: "lista os seus tópicos",
+		Chats:       bh.ChatsGroup,
+	}, bh.NoArgs(c.ListUserTopics))
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "listudo",
+		Description: "lista todos os tópicos do chat",
+		Chats:       bh.ChatsGroup,
+	}, bh.NoArgs(c.ListChatTopics))
 	// c.Handle(tgh.Command("conta"), h.CountEvent)
 	// c.Handle(tgh.Command("desconta"), h.UncountEvent)
-	uh.Handle(bh.Command("a"), c.SaveAudio)
-	uh.Handle(bh.Command("arand"), c.SendRandomAudio)
-	uh.Handle(bh.Command("ask"), c.GPTCompletion)
-	uh.Handle(bh.Command("cask"), c.GPTChatCompletion)
-	uh.Handle(bh.Command("backup"), c.RequireGod(c.Backup))
-	uh.Handle(bh.Command("xonotic"), c.Xonotic)
-	uh.Handle(bh.AnyCallbackQuery, c.CallbackQuery)
-	uh.Handle(bh.AnyInlineQuery, c.InlineQuery)
-
-	// switches
-	uh.Handle(bh.Command("enable_create_topics"), c.RequireAdmin(c.Enable("create_topics")))
-	uh.Handle(bh.Command("disable_create_topics"), c.RequireAdmin(c.Disable("create_topics")))
-	uh.Handle(bh.Command("enable_audio"), c.RequireAdmin(c.Enable("audio")))
-	uh.Handle(bh.Command("disable_audio"), c.RequireAdmin(c.Disable("audio")))
-	uh.Handle(bh.Command("enable_ask"), c.RequireAdmin(c.Enable("ask")))
-	uh.Handle(bh.Command("disable_ask"), c.RequireAdmin(c.Disable("ask")))
-	uh.Handle(bh.Command("enable_cask"), c.RequireAdmin(c.Enable("cask")))
-	uh.Handle(bh.Command("disable_cask"), c.RequireAdmin(c.Disable("cask")))
-	uh.Handle(bh.Command("enable_sed"), c.RequireAdmin(c.Enable("sed")))
-	uh.Handle(bh.Command("disable_sed"), c.RequireAdmin(c.Disable("sed")))
+
+	// audios
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "a",
+		Description: "salva o áudio respondido",
+		Reply:       "responda ao áudio que quer salvar",
+		Args: []bh.Arg{
+			{Name: "nome", Description: "nome do áudio"},
+			{Name: "tags", Description: "tags para achar o áudio", Optional: true, Variadic: true},
+		},
+	}, c.SaveAudio)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "arand",
+		Description: "manda um áudio aleatório",
+		Args:        []bh.Arg{{Name: "tag", Description: "só áudios com essa tag", Optional: true}},
+	}, c.SendRandomAudio)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "audio",
+		Description: "manda um áudio pelo nome",
+		Args:        []bh.Arg{{Name: "nome", Description: "nome do áudio"}},
+	}, c.SendAudio)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "audios",
+		Description: "lista os áudios salvos",
+	}, bh.NoArgs(c.ListAudios))
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "aren",
+		Description: "renomeia um áudio (quem salvou ou admin)",
+		Args: []bh.Arg{
+			{Name: "nome", Description: "nome atual"},
+			{Name: "novo nome", Description: "nome novo"},
+		},
+	}, c.RenameAudio)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "adel",
+		Description: "apaga um áudio (quem salvou ou admin)",
+		Args:        []bh.Arg{{Name: "nome", Description: "nome do áudio"}},
+	}, c.DeleteAudio)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "inline",
+		Description: "usa os áudios desse grupo no modo inline",
+		Chats:       bh.ChatsGroup,
+	}, c.InlineChat)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "transcrever",
+		Description: "transcreve a mensagem de voz respondida",
+		Reply:       "responda a uma mensagem de voz",
+	}, c.Transcribe)
+
+	// chatGPT
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "ask",
+		Description: "pergunta ao ChatGPT",
+		Args:        []bh.Arg{{Name: "pergunta", Description: "o que perguntar", Text: true}},
+	}, c.GPTCompletion)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "cask",
+		Description: "pergunta ao ChatGPT usando a conversa como contexto",
+		Args:        []bh.Arg{{Name: "pergunta", Description: "o que perguntar", Text: true}},
+	}, c.GPTChatCompletion)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "resumo",
+		Description: "resume a conversa",
+		Args:        []bh.Arg{{Name: "período", Description: "N horas ou desde ontem. respondendo a uma mensagem, resume desde ela", Optional: true, Text: true}},
+	}, c.Summarize)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "busca",
+		Description: "busca mensagens salvas",
+		Args:        []bh.Arg{{Name: "termos", Description: "termos a buscar", Text: true}},
+	}, c.Search)
+
+	// privacy
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "esquecer",
+		Description: "apaga a mensagem respondida do histórico (autor ou admin)",
+		Reply:       "responda à mensagem que quer esquecer",
+		Args:        []bh.Arg{{Name: "tudo", Description: "apaga também as respostas", Optional: true}},
+	}, c.Forget)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "privacidade",
+		Description: "para de salvar as suas mensagens no chat",
+		Args:        []bh.Arg{{Name: "on|off", Description: "on para de salvar e apaga as salvas, off volta a salvar", Optional: true}},
+	}, c.Privacy)
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "meusdados",
+		Description: "manda os seus dados salvos",
+	}, bh.NoArgs(c.MyData))
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "retencao",
+		Description: "define por quanto tempo as mensagens são guardadas",
+		Args: []bh.Arg{
+			{Name: "modo", Description: "dias, mensagens ou off", Optional: true},
+			{Name: "N", Description: "número de dias ou de mensagens", Optional: true},
+		},
+		Permission: bh.PermissionAdmin,
+		Chats:      bh.ChatsGroup,
+	}, c.Retention)
+
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "config",
+		Description: "mostra as configurações do grupo para ativar ou desativar",
+		Permission:  bh.PermissionAdmin,
+		Chats:       bh.ChatsGroup,
+	}, bh.NoArgs(c.ChatConfig))
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "backup",
+		Description: "faz um backup do banco de dados e manda aqui",
+		Permission:  bh.PermissionGod,
+		Chats:       bh.ChatsPrivate,
+	}, bh.NoArgs(c.Backup))
+	uh.HandleCommand(bh.CommandSpec{
+		Name:        "xonotic",
+		Description: "mostra quem está jogando xonotic",
+		Hidden:      true,
+	}, bh.NoArgs(c.Xonotic))
+
+	uh.HandleCallback(bh.CallbackDataPrefix("busca:"), c.SearchPage)
+	uh.HandleCallback(bh.CallbackDataPrefix("audios:"), c.AudiosPage)
+	uh.HandleCallback(bh.CallbackDataPrefix("config:"), c.ChatConfigToggle)
+	uh.HandleCallback(nil, c.CallbackQuery)
+	uh.HandleInline(nil, c.InlineQuery)
+	uh.HandlePollAnswer(nil, c.PollAnswer)
+	uh.HandleChatMember(nil, c.ChatMember)
+	uh.Handle(bh.AnyEditedMessage, c.EditedMessage)
 
 	// TODO: text containing #topic
 	uh.Handle(bh.AnyText, c.Text)
+	uh.HandleMessage(nil, c.Media)
+}
+
+// updateSource records the updates if enabled in the config
+func updateSource(conf config.Config, updates <-chan bot.Update) (<-chan bot.Update, error) {
+	if conf.RecordUpdates == "" {
+		return updates, nil
+	}
+
+	rec, err := botrecord.NewRecorder(conf.RecordUpdates, conf.RecordTexts)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Tee(updates), nil
+}
 
-	uh.Start()
+// logDispatcherStats logs the queue depths while there are updates waiting
+func logDispatcherStats(d *bh.Dispatcher) {
+	for range time.Tick(time.Minute) {
+		stats := d.Stats()
+		if stats.Pending == 0 {
+			continue
+		}
+		log.Printf("dispatcher: %d updates pending in %d queues (max %d): %v",
+			stats.Pending, stats.Keys, stats.MaxPending, stats.Depths)
+	}
 }
@@ -1,10 +1,24 @@
 package openai
 
+import (
+	"context"
+	"time"
+)
+
 type Service interface {
 	Completion(params *CompletionParams) (*CompletionResponse, error)
+	Embeddings(params *EmbeddingsParams) (*EmbeddingsResponse, error)
+	Transcription(params *TranscriptionParams) (*TranscriptionResponse, error)
+	// RateLimitDeadline returns when the current rate limit window ends.
+	// It is the zero time if the service is not rate limited.
+	RateLimitDeadline() time.Time
 }
 
 type CompletionParams struct {
+	// Context cancels the request. It defaults to context.Background().
+	Context context.Context
+	// WaitRateLimit makes the call wait for the rate limit to end
+	// instead of failing with ErrRateLimit
 	WaitRateLimit bool
 	Model         string
 	Messages      []Message
@@ -21,6 +35,40 @@ type CompletionResponse struct {
 	}
 }
 
+type EmbeddingsParams struct {
+	// Context cancels the request. It defaults to context.Background().
+	Context       context.Context
+	WaitRateLimit bool
+	Model         string
+	Input         []string
+}
+
+type EmbeddingsResponse struct {
+	Model string `json:"model"`
+	// Data has one embedding for each input, in the same order
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+type TranscriptionParams struct {
+	// Context cancels the request. It defaults to context.Background().
+	Context       context.Context
+	WaitRateLimit bool
+	Model         string
+	// FileName tells the audio format by its extension, e.g. "voice.ogg"
+	FileName string
+	Audio    []byte
+	// Language is the ISO-639-1 code of the audio language. It improves accuracy.
+	Language string
+}
+
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// ErrRateLimit holds how many seconds remain until the rate limit ends
 type ErrRateLimit int
 
 func (err ErrRateLimit) Error() string {
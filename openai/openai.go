@@ -2,40 +2,84 @@ package openai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"mime/multipart"
 	"net/http"
-	"sync"
+	"sort"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/igoracmelo/euperturbot/util"
 )
 
+const (
+	// used when a 429 response doesn't say when the limit ends
+	defaultRateLimit = 30 * time.Second
+	maxAttempts      = 5
+	retryDelay       = 500 * time.Millisecond
+)
+
 type service struct {
 	key               string
+	baseURL           string
+	model             string
 	http              *http.Client
-	mut               *sync.Mutex
 	rateLimitDeadline *atomic.Value
+	after             func(time.Duration) <-chan time.Time
+}
+
+type Options struct {
+	// BaseURL is where the API is, without the trailing slash.
+	// Defaults to https://api.openai.com/v1.
+	BaseURL string
+	// Model is used by the completions that don't set one. Defaults to gpt-3.5-turbo.
+	Model string
 }
 
 func NewService(key string, http *http.Client) Service {
+	return NewServiceWithOptions(key, http, Options{})
+}
+
+func NewServiceWithOptions(key string, http *http.Client, opts Options) Service {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://api.openai.com/v1"
+	}
+	if opts.Model == "" {
+		opts.Model = "gpt-3.5-turbo"
+	}
+
 	deadline := &atomic.Value{}
 	deadline.Store(time.Time{})
 	return &service{
 		key:               key,
+		baseURL:           strings.TrimSuffix(opts.BaseURL, "/"),
+		model:             opts.Model,
 		http:              http,
-		mut:               new(sync.Mutex),
 		rateLimitDeadline: deadline,
+		after:             time.After,
 	}
 }
 
+func (s *service) RateLimitDeadline() time.Time {
+	return s.rateLimitDeadline.Load().(time.Time)
+}
+
 func (s *service) Completion(params *CompletionParams) (*CompletionResponse, error) {
 	if params.Model == "" {
-		params.Model = "gpt-3.5-turbo"
+		params.Model = s.model
 	}
 	if params.Temperature == 0 {
 		params.Temperature = 0.7
 	}
+	if params.Context == nil {
+		params.Context = context.Background()
+	}
 
 	for i, m := range params.Messages {
 		if m.Role == "" {
@@ -50,33 +94,246 @@ func (s *service) Completion(params *CompletionParams) (*CompletionResponse, err
 		"temperature": params.Temperature,
 	}
 
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.post(params.Context, s.baseURL+"/chat/completions", "application/json", body, params.WaitRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var completion CompletionResponse
+	err = json.NewDecoder(resp.Body).Decode(&completion)
+	return &completion, err
+}
+
+func (s *service) Embeddings(params *EmbeddingsParams) (*EmbeddingsResponse, error) {
+	if params.Model == "" {
+		params.Model = "text-embedding-ada-002"
+	}
+	if params.Context == nil {
+		params.Context = context.Background()
+	}
+
+	payload := map[string]any{
+		"model": params.Model,
+		"input": params.Input,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.post(params.Context, s.baseURL+"/embeddings", "application/json", body, params.WaitRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var embeddings EmbeddingsResponse
+	err = json.NewDecoder(resp.Body).Decode(&embeddings)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(embeddings.Data, func(i, j int) bool {
+		return embeddings.Data[i].Index < embeddings.Data[j].Index
+	})
+	if len(embeddings.Data) != len(params.Input) {
+		return nil, fmt.Errorf("embeddings: want %d, got %d", len(params.Input), len(embeddings.Data))
+	}
+
+	return &embeddings, nil
+}
+
+func (s *service) Transcription(params *TranscriptionParams) (*TranscriptionResponse, error) {
+	if params.Model == "" {
+		params.Model = "whisper-1"
+	}
+	if params.Context == nil {
+		params.Context = context.Background()
+	}
+
 	body := &bytes.Buffer{}
-	err := json.NewEncoder(body).Encode(payload)
+	mw := multipart.NewWriter(body)
+
+	part, err := mw.CreateFormFile("file", params.FileName)
 	if err != nil {
 		return nil, err
 	}
+	_, err = part.Write(params.Audio)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{
+		"model":           params.Model,
+		"language":        params.Language,
+		"response_format": "json",
+	}
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		err = mw.WriteField(k, v)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", body)
+	err = mw.Close()
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.key)
 
-	resp, err := s.http.Do(req)
+	resp, err := s.post(params.Context, s.baseURL+"/audio/transcriptions", mw.FormDataContentType(), body.Bytes(), params.WaitRateLimit)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 429 {
-		return nil, ErrRateLimit(30)
+	var transcription TranscriptionResponse
+	err = json.NewDecoder(resp.Body).Decode(&transcription)
+	return &transcription, err
+}
+
+// post sends the request, keeping track of the rate limit and retrying server errors.
+// The returned response always has status 200.
+func (s *service) post(ctx context.Context, url string, contentType string, body []byte, waitRateLimit bool) (*http.Response, error) {
+	var resp *http.Response
+
+	for attempt := 1; ; attempt++ {
+		err := s.waitRateLimit(ctx, waitRateLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+s.key)
+
+		resp, err = s.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			s.extendRateLimit(time.Now().Add(rateLimitReset(resp.Header, time.Now())))
+			if waitRateLimit && attempt < maxAttempts {
+				continue
+			}
+			return nil, s.rateLimitErr()
+		}
+
+		if resp.StatusCode >= 500 && attempt < maxAttempts {
+			resp.Body.Close()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-s.after(backoff(attempt)):
+			}
+			continue
+		}
+
+		break
 	}
+
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		return nil, util.HTTPResponseError(resp)
 	}
 
-	var completion CompletionResponse
-	err = json.NewDecoder(resp.Body).Decode(&completion)
-	return &completion, err
+	// the request went through but it was the last one allowed in this window
+	if resp.Header.Get("x-ratelimit-remaining-requests") == "0" {
+		d, err := time.ParseDuration(resp.Header.Get("x-ratelimit-reset-requests"))
+		if err == nil {
+			s.extendRateLimit(time.Now().Add(d))
+		}
+	}
+
+	return resp, nil
+}
+
+// waitRateLimit returns ErrRateLimit if the service is rate limited, or blocks
+// until the limit ends if wait is true. It waits again if the limit is
+// extended meanwhile, and stops when the context is done.
+func (s *service) waitRateLimit(ctx context.Context, wait bool) error {
+	for {
+		d := time.Until(s.RateLimitDeadline())
+		if d <= 0 {
+			return nil
+		}
+		if !wait {
+			return s.rateLimitErr()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.after(d):
+		}
+	}
+}
+
+func (s *service) rateLimitErr() ErrRateLimit {
+	secs := math.Ceil(time.Until(s.RateLimitDeadline()).Seconds())
+	if secs < 1 {
+		secs = 1
+	}
+	return ErrRateLimit(secs)
+}
+
+// extendRateLimit moves the deadline forward. It never moves it backward, since
+// concurrent responses may report different resets for different limits.
+func (s *service) extendRateLimit(deadline time.Time) {
+	for {
+		old := s.RateLimitDeadline()
+		if !deadline.After(old) {
+			return
+		}
+		if s.rateLimitDeadline.CompareAndSwap(old, deadline) {
+			return
+		}
+	}
+}
+
+// rateLimitReset reads how long to wait from the headers of a 429 response.
+// retry-after takes precedence over the x-ratelimit-reset-* headers.
+func rateLimitReset(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("retry-after"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil && t.After(now) {
+			return t.Sub(now)
+		}
+	}
+
+	// x-ratelimit-reset-* come as durations, e.g. "1s", "6m0s", "120ms"
+	var reset time.Duration
+	for _, name := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		d, err := time.ParseDuration(h.Get(name))
+		if err == nil && d > reset {
+			reset = d
+		}
+	}
+	if reset > 0 {
+		return reset
+	}
+
+	return defaultRateLimit
+}
+
+// backoff returns the delay before retrying the given attempt, with jitter
+func backoff(attempt int) time.Duration {
+	d := retryDelay * time.Duration(1<<(attempt-1))
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
 }
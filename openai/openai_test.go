@@ -1,10 +1,13 @@
 package openai
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 type RoundTripFunc func(req *http.Request) (*http.Response, error)
@@ -13,6 +16,13 @@ func (fn RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return fn(req)
 }
 
+// fired returns a timer channel that has already fired
+func fired() <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- time.Now()
+	return ch
+}
+
 func Test(t *testing.T) {
 	// Arrange
 
@@ -63,3 +73,390 @@ func Test(t *testing.T) {
 		t.Fatalf("content - want: '%s', got: '%s'", wantContent, gotContent)
 	}
 }
+
+func TestCompletionRateLimit(t *testing.T) {
+	calls := 0
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			h := http.Header{}
+			h.Set("retry-after", "20")
+			return &http.Response{
+				StatusCode: 429,
+				Header:     h,
+				Body:       io.NopCloser(strings.NewReader("")),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	s := NewService("", &http)
+
+	_, err := s.Completion(&CompletionParams{})
+	var rateErr ErrRateLimit
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("err - want: ErrRateLimit, got: %v", err)
+	}
+	if rateErr < 19 || rateErr > 20 {
+		t.Fatalf("rate limit - want: 20s, got: %ds", int(rateErr))
+	}
+
+	until := time.Until(s.RateLimitDeadline())
+	if until < 19*time.Second || until > 20*time.Second {
+		t.Fatalf("deadline - want: in 20s, got: in %s", until)
+	}
+
+	// while limited, requests must not even be sent
+	_, err = s.Completion(&CompletionParams{})
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("err - want: ErrRateLimit, got: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("calls - want: 1, got: %d", calls)
+	}
+}
+
+func TestCompletionWaitRateLimit(t *testing.T) {
+	calls := 0
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 1 {
+				h := http.Header{}
+				h.Set("x-ratelimit-reset-requests", "1m0s")
+				h.Set("x-ratelimit-reset-tokens", "250ms")
+				return &http.Response{
+					StatusCode: 429,
+					Header:     h,
+					Body:       io.NopCloser(strings.NewReader("")),
+					Request:    r,
+				}, nil
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(`{"choices": []}`)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	s := NewService("", &http).(*service)
+	var slept time.Duration
+	s.after = func(d time.Duration) <-chan time.Time {
+		slept += d
+		// pretend the time has passed
+		s.rateLimitDeadline.Store(time.Time{})
+		return fired()
+	}
+
+	_, err := s.Completion(&CompletionParams{WaitRateLimit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("calls - want: 2, got: %d", calls)
+	}
+	if slept < 59*time.Second || slept > time.Minute {
+		t.Fatalf("slept - want: 1m, got: %s", slept)
+	}
+}
+
+func TestWaitRateLimitCanceled(t *testing.T) {
+	calls := 0
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			return nil, errors.New("unexpected request")
+		}),
+	}
+
+	s := NewService("", &http).(*service)
+	s.rateLimitDeadline.Store(time.Now().Add(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := s.Completion(&CompletionParams{Context: ctx, WaitRateLimit: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err - want: %v, got: %v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("waited - want: until canceled, got: %s", elapsed)
+	}
+	if calls != 0 {
+		t.Fatalf("calls - want: 0, got: %d", calls)
+	}
+}
+
+func TestWaitRateLimitConcurrent(t *testing.T) {
+	s := NewService("", &http.Client{}).(*service)
+	s.rateLimitDeadline.Store(time.Now().Add(time.Minute))
+
+	timer := make(chan time.Time)
+	waiting := make(chan struct{}, 2)
+	s.after = func(d time.Duration) <-chan time.Time {
+		waiting <- struct{}{}
+		return timer
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- s.waitRateLimit(context.Background(), true)
+		}()
+	}
+
+	// both callers wait at the same time instead of one behind the other
+	for i := 0; i < 2; i++ {
+		select {
+		case <-waiting:
+		case <-time.After(time.Second):
+			t.Fatalf("waiting callers - want: 2, got: %d", i)
+		}
+	}
+
+	s.rateLimitDeadline.Store(time.Time{})
+	close(timer)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompletionRetryServerError(t *testing.T) {
+	statuses := []int{500, 503, 200}
+	calls := 0
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(r.Body)
+			if len(body) == 0 {
+				t.Errorf("attempt %d - empty request body", calls+1)
+			}
+			status := statuses[calls]
+			calls++
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader(`{"choices": []}`)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	s := NewService("", &http).(*service)
+	sleeps := 0
+	s.after = func(d time.Duration) <-chan time.Time {
+		sleeps++
+		return fired()
+	}
+
+	_, err := s.Completion(&CompletionParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("calls - want: 3, got: %d", calls)
+	}
+	if sleeps != 2 {
+		t.Fatalf("sleeps - want: 2, got: %d", sleeps)
+	}
+}
+
+func Test_rateLimitReset(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		headers map[string]string
+		want    time.Duration
+	}{
+		{map[string]string{}, defaultRateLimit},
+		{map[string]string{"retry-after": "7"}, 7 * time.Second},
+		{map[string]string{"retry-after": "1.5"}, 1500 * time.Millisecond},
+		{map[string]string{"retry-after": now.Add(time.Minute).Format(http.TimeFormat)}, time.Minute},
+		{map[string]string{"x-ratelimit-reset-requests": "6m0s"}, 6 * time.Minute},
+		{map[string]string{"x-ratelimit-reset-tokens": "120ms"}, 120 * time.Millisecond},
+		{map[string]string{"x-ratelimit-reset-requests": "2s", "x-ratelimit-reset-tokens": "3.5s"}, 3500 * time.Millisecond},
+		{map[string]string{"retry-after": "1", "x-ratelimit-reset-requests": "10s"}, time.Second},
+		{map[string]string{"retry-after": "garbage"}, defaultRateLimit},
+	}
+
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.headers {
+			h.Set(k, v)
+		}
+		got := rateLimitReset(h, now)
+		if tt.want != got {
+			t.Errorf("%v - want: %s, got: %s", tt.headers, tt.want, got)
+		}
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	// out of order on purpose
+	payload := `{
+		"model": "text-embedding-ada-002",
+		"data": [
+			{ "index": 1, "embedding": [0.3, 0.4] },
+			{ "index": 0, "embedding": [0.1, 0.2] }
+		]
+	}`
+
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(payload)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	s := NewService("", &http)
+
+	res, err := s.Embeddings(&EmbeddingsParams{
+		Input: []string{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]float32{{0.1, 0.2}, {0.3, 0.4}}
+	for i := range want {
+		got := res.Data[i].Embedding
+		if len(got) != 2 || got[0] != want[i][0] || got[1] != want[i][1] {
+			t.Fatalf("embedding %d - want: %v, got: %v", i, want[i], got)
+		}
+	}
+}
+
+func TestTranscription(t *testing.T) {
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if r.URL.Path != "/v1/audio/transcriptions" {
+				t.Errorf("path - want: /v1/audio/transcriptions, got: %s", r.URL.Path)
+			}
+
+			err := r.ParseMultipartForm(1 << 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.FormValue("model"); got != "whisper-1" {
+				t.Errorf("model - want: whisper-1, got: %s", got)
+			}
+			if got := r.FormValue("language"); got != "pt" {
+				t.Errorf("language - want: pt, got: %s", got)
+			}
+
+			f, header, err := r.FormFile("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			audio, _ := io.ReadAll(f)
+			if header.Filename != "voice.ogg" || string(audio) != "audio" {
+				t.Errorf("file - want: voice.ogg with 'audio', got: %s with '%s'", header.Filename, audio)
+			}
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(`{"text": "olá mundo"}`)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	s := NewService("", &http)
+
+	res, err := s.Transcription(&TranscriptionParams{
+		FileName: "voice.ogg",
+		Audio:    []byte("audio"),
+		Language: "pt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Text != "olá mundo" {
+		t.Fatalf("text - want: 'olá mundo', got: '%s'", res.Text)
+	}
+}
+
+func TestCompletionContextCanceled(t *testing.T) {
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		}),
+	}
+
+	s := NewService("", &http)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.Completion(&CompletionParams{
+		Context:  ctx,
+		Messages: []Message{{Content: "hello"}},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err - want: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestEmbeddingsContextCanceled(t *testing.T) {
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		}),
+	}
+
+	s := NewService("", &http)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.Embeddings(&EmbeddingsParams{
+		Context: ctx,
+		Input:   []string{"hello"},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err - want: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestServiceOptions(t *testing.T) {
+	var gotURL string
+	var gotBody string
+
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			gotURL = r.URL.String()
+			b, _ := io.ReadAll(r.Body)
+			gotBody = string(b)
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(`{"choices": []}`)),
+			}, nil
+		}),
+	}
+
+	s := NewServiceWithOptions("", &http, Options{
+		BaseURL: "http://localhost:8080/v1/",
+		Model:   "llama",
+	})
+	_, err := s.Completion(&CompletionParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotURL != "http://localhost:8080/v1/chat/completions" {
+		t.Fatalf("url - want: %s, got: %s", "http://localhost:8080/v1/chat/completions", gotURL)
+	}
+	if !strings.Contains(gotBody, `"model":"llama"`) {
+		t.Fatalf("body - want model llama, got: %s", gotBody)
+	}
+}
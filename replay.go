@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/bot/botrecord"
+	"github.com/igoracmelo/euperturbot/config"
+	"github.com/igoracmelo/euperturbot/controller"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo"
+)
+
+// the bot as seen by the replayed updates
+var replayBot = bot.User{
+	ID:        1,
+	IsBot:     true,
+	FirstName: "euperturbot",
+	Username:  "euperturbot",
+}
+
+// replayCmd replays the updates recorded in the file and prints the calls to stdout.
+// The config file is used if it exists, without its tokens.
+func replayCmd(args []string) error {
+	args, opts, err := parseArgs("replay", args, 1)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	updates, err := botrecord.ReadUpdates(f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", args[0], err)
+	}
+
+	conf, err := opts.loadConfig()
+	if err != nil {
+		return err
+	}
+	conf.BotToken = ""
+	conf.OpenAIKey = ""
+	conf.RecordUpdates = ""
+
+	return replay(os.Stdout, updates, conf)
+}
+
+// replay handles the updates one at a time, in order, with an empty in-memory
+// database and fake telegram and OpenAI services. Every call to them is
+// printed to w.
+func replay(w io.Writer, updates []bot.Update, conf config.Config) error {
+	db, err := sqliterepo.Open(context.TODO(), ":memory:", conf.Migrations)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out := &syncWriter{w: w, mut: new(sync.Mutex)}
+	fake := botrecord.NewFakeService(out, replayBot)
+	oai := openai.NewService("", &http.Client{
+		Transport: offlineTransport{w: out},
+	})
+
+	source := make(chan bot.Update)
+	uh := bh.NewUpdateHandler(fake, source)
+	// a single queue makes the output deterministic
+	uh.Key = func(u bot.Update) string {
+		return "replay"
+	}
+
+	me := replayBot
+	c := controller.Controller{
+		Repo:     db,
+		OpenAI:   oai,
+		BotInfo:  &me,
+		Config:   &conf,
+		Inline:   controller.NewInlineCoordinator(0, time.Minute),
+		Members:  controller.NewMemberCache(time.Minute),
+		Commands: uh.Commands,
+	}
+	handle(uh, c)
+
+	go func() {
+		for _, u := range updates {
+			source <- u
+		}
+		close(source)
+	}()
+	uh.Start()
+
+	return nil
+}
+
+// offlineTransport prints the requests and fails them without touching the network
+type offlineTransport struct {
+	w io.Writer
+}
+
+func (t offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	fmt.Fprintf(t.w, "openai %s %s\n", req.Method, req.URL.Path)
+	return nil, errors.New("replay: openai is offline")
+}
+
+type syncWriter struct {
+	w   io.Writer
+	mut *sync.Mutex
+}
+
+func (w *syncWriter) Write(b []byte) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.w.Write(b)
+}
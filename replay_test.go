@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/bot/botrecord"
+	"github.com/igoracmelo/euperturbot/config"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// TestReplay replays each testdata/replay/*.jsonl and compares the calls
+// with the .golden file next to it
+func TestReplay(t *testing.T) {
+	paths, err := filepath.Glob("testdata/replay/*.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			updates, err := botrecord.ReadUpdates(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := &bytes.Buffer{}
+			err = replay(got, updates, config.Default())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(path, ".jsonl") + ".golden"
+			if *update {
+				err = os.WriteFile(golden, got.Bytes(), 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Fatalf("calls - want:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+// TestReplayHandlesEveryUpdate replays more updates than the queue of a key
+// holds, so the source has to wait for room instead of losing updates
+func TestReplayHandlesEveryUpdate(t *testing.T) {
+	const n = 1000
+
+	updates := []bot.Update{}
+	for i := 1; i <= n; i++ {
+		updates = append(updates, bot.Update{
+			UpdateID: i,
+			Message: &bot.Message{
+				MessageID: i,
+				Text:      "/start",
+				From:      &bot.User{ID: 100, FirstName: "Ana"},
+				Chat:      &bot.Chat{ID: 100, Type: "private", FirstName: "Ana"},
+			},
+		})
+	}
+
+	got := &bytes.Buffer{}
+	err := replay(got, updates, config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= n; i++ {
+		reply := fmt.Sprintf(`"reply_to_message_id":%d,`, i)
+		if !strings.Contains(got.String(), reply) {
+			t.Fatalf("update %d - want: handled, got: no reply", i)
+		}
+	}
+	if c := strings.Count(got.String(), "sendMessage"); c != n {
+		t.Fatalf("replies - want: %d, got: %d", n, c)
+	}
+}
@@ -0,0 +1,42 @@
+package repo
+
+import "fmt"
+
+// Feature is a switch admins turn on or off in each chat
+type Feature string
+
+const (
+	FeatureCreateTopics Feature = "create_topics"
+	FeatureAudio        Feature = "audio"
+	FeatureAsk          Feature = "ask"
+	FeatureCAsk         Feature = "cask"
+	FeatureSed          Feature = "sed"
+	FeatureTranscribe   Feature = "transcribe"
+)
+
+type FeatureInfo struct {
+	Feature Feature
+	// Description is shown to the users, in portuguese
+	Description string
+	// Default is the state of the chats that never changed the switch
+	Default bool
+}
+
+// Features are all the switches, in the order they are shown
+var Features = []FeatureInfo{
+	{FeatureCreateTopics, "criação de tópicos por qualquer um", false},
+	{FeatureAudio, "comandos de áudio", false},
+	{FeatureAsk, "/ask", false},
+	{FeatureCAsk, "/cask e o histórico de mensagens", false},
+	{FeatureSed, "substituições com s/a/b/", false},
+	{FeatureTranscribe, "/transcrever", false},
+}
+
+func LookupFeature(f Feature) (FeatureInfo, error) {
+	for _, info := range Features {
+		if info.Feature == f {
+			return info, nil
+		}
+	}
+	return FeatureInfo{}, fmt.Errorf("unknown feature %q", f)
+}
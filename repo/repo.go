@@ -9,15 +9,34 @@ import (
 
 type Repo interface {
 	Close() error
+	// Backup writes a consistent copy of the database to dest while it is in use
+	Backup(ctx context.Context, dest string) error
 	SaveChat(ctx context.Context, chat Chat) error
 	FindChat(ctx context.Context, chatID int64) (*Chat, error)
-	ChatEnables(ctx context.Context, chatID int64, action string) (bool, error)
-	ChatEnable(ctx context.Context, chatID int64, action string) error
-	ChatDisable(ctx context.Context, chatID int64, action string) error
+	ChatEnables(ctx context.Context, chatID int64, f Feature) (bool, error)
+	FindChatFeatures(ctx context.Context, chatID int64) (map[Feature]bool, error)
+	SetChatFeature(ctx context.Context, chatID int64, f Feature, enabled bool) error
 	SaveMessage(ctx context.Context, msg Message) error
 	FindMessage(ctx context.Context, chatID int64, msgID int) (Message, error)
+	EditMessage(ctx context.Context, chatID int64, msgID int, text string, caption string, date time.Time) error
+	SaveTranscription(ctx context.Context, chatID int64, msgID int, text string) error
+	FindMessageRevisions(ctx context.Context, chatID int64, msgID int) ([]MessageRevision, error)
+	DeleteMessage(ctx context.Context, chatID int64, msgID int, withReplies bool) (int64, error)
 	FindMessagesBeforeDate(ctx context.Context, chatID int64, date time.Time, count int) ([]Message, error)
+	FindMessagesBetweenDates(ctx context.Context, chatID int64, start time.Time, end time.Time) ([]Message, error)
 	FindMessageThread(ctx context.Context, chatID int64, msgID int) ([]Message, error)
+	SearchMessages(ctx context.Context, chatID int64, terms string, limit int, offset int) ([]MessageSearchResult, error)
+	FindMessagesWithoutEmbedding(ctx context.Context, count int) ([]Message, error)
+	SaveMessageEmbedding(ctx context.Context, e MessageEmbedding) error
+	SaveMessageEmbeddingFailure(ctx context.Context, chatID int64, msgID int) error
+	FindSimilarMessages(ctx context.Context, chatID int64, vector []float32, before time.Time, count int) ([]Message, error)
+	SetMessageOptOut(ctx context.Context, chatID int64, userID int64, optOut bool) error
+	FindMessageOptOuts(ctx context.Context, chatID int64) ([]int64, error)
+	DeleteUserMessages(ctx context.Context, chatID int64, userID int64) (int64, error)
+	FindUserData(ctx context.Context, userID int64) (*UserData, error)
+	SaveRetentionPolicy(ctx context.Context, p RetentionPolicy) error
+	FindRetentionPolicy(ctx context.Context, chatID int64) (*RetentionPolicy, error)
+	PruneMessages(ctx context.Context) (int64, error)
 	SaveUser(u User) error
 	FindUser(id int64) (*User, error)
 	ExistsChatTopic(chatID int64, topic string) (bool, error)
@@ -27,23 +46,32 @@ type Repo interface {
 	FindChatTopics(chatID int64) ([]UserTopic, error)
 	FindUsersByTopic(chatID int64, topic string) ([]User, error)
 	SavePoll(p Poll) error
+	FindPoll(id string) (*Poll, error)
 	FindPollByMessage(msgID int) (*Poll, error)
 	SavePollVote(v PollVote) error
 	DeletePollVote(pollID string, userID int64) error
 	FindPollVote(pollID string, userID int64) (*PollVote, error)
 	SaveVoice(v Voice) error
-	FindRandomVoice(chatID int64) (*Voice, error)
+	FindRandomVoice(chatID int64, tag string) (*Voice, error)
+	FindVoice(ctx context.Context, chatID int64, name string) (*Voice, error)
+	FindVoices(ctx context.Context, chatID int64, limit int, offset int) ([]Voice, error)
+	RenameVoice(ctx context.Context, chatID int64, name string, newName string) error
+	DeleteVoice(ctx context.Context, chatID int64, name string) error
+	SearchVoices(ctx context.Context, chatID int64, query string, limit int, offset int) ([]Voice, error)
+	SaveInlineChat(ctx context.Context, userID int64, chatID int64) error
+	FindInlineChat(ctx context.Context, userID int64) (int64, error)
 }
 
 var (
 	ErrChatActionNotAllowed = errors.New("chat action not allowed")
 	ErrNotFound             = sql.ErrNoRows // FIXME
+	ErrVoiceNameTaken       = errors.New("voice name taken")
+	ErrVoiceAlreadySaved    = errors.New("voice already saved")
 )
 
 type Chat struct {
-	ID         int64
-	Title      string
-	EnableCAsk bool
+	ID    int64
+	Title string
 }
 
 type Message struct {
@@ -54,6 +82,57 @@ type Message struct {
 	UserID           int64  `db:"user_id"`
 	UserName         string `db:"user_name"`
 	ReplyToMessageID int    `db:"reply_to_message_id"`
+	ContentType      string `db:"content_type"`
+	Caption          string
+	FileID           string `db:"file_id"`
+	StickerEmoji     string `db:"sticker_emoji"`
+	// ForwardOrigin is the name of who sent the message originally, if it was forwarded
+	ForwardOrigin string `db:"forward_origin"`
+}
+
+const (
+	ContentTypeText     = "text"
+	ContentTypePhoto    = "photo"
+	ContentTypeSticker  = "sticker"
+	ContentTypeVoice    = "voice"
+	ContentTypeDocument = "document"
+)
+
+// MessageRevision is a previous version of an edited message
+type MessageRevision struct {
+	ID        int64
+	ChatID    int64 `db:"chat_id"`
+	MessageID int   `db:"message_id"`
+	Text      string
+	Caption   string
+	Date      time.Time
+}
+
+// MessageSearchResult is a message matching a search, with the matched terms
+// wrapped by SnippetMatchStart and SnippetMatchEnd in Snippet
+type MessageSearchResult struct {
+	Message
+	Snippet string
+}
+
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+type MessageEmbedding struct {
+	ChatID    int64
+	MessageID int
+	Model     string
+	Vector    []float32
+}
+
+// RetentionPolicy limits how many messages are kept in a chat.
+// Zero values mean no limit.
+type RetentionPolicy struct {
+	ChatID  int64
+	MaxAge  time.Duration
+	MaxRows int
 }
 
 type Poll struct {
@@ -87,6 +166,18 @@ func (u *User) Name() string {
 	return u.FirstName
 }
 
+// UserData is everything stored about a user, across all chats
+type UserData struct {
+	User      *User
+	Topics    []UserTopic
+	PollVotes []PollVote
+	Messages  []Message
+	// MessageRevisions are the previous versions of the messages
+	MessageRevisions []MessageRevision
+	Voices           []Voice
+	MessageOptOuts   []int64 // chat ids
+}
+
 type UserTopic struct {
 	ID          int64
 	ChatID      int64 `db:"chat_id"`
@@ -96,7 +187,16 @@ type UserTopic struct {
 }
 
 type Voice struct {
-	FileID string `db:"file_id"`
-	UserID int64  `db:"user_id"`
+	ID     int64
 	ChatID int64  `db:"chat_id"`
+	FileID string `db:"file_id"`
+	// UserID is who sent the audio
+	UserID int64 `db:"user_id"`
+	// SavedBy is who saved the audio in the library
+	SavedBy     int64  `db:"saved_by"`
+	SavedByName string `db:"saved_by_name"`
+	Name        string
+	// Label is a free description of the audio, like its transcription
+	Label string
+	Tags  []string `db:"-"`
 }
@@ -0,0 +1,96 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Backup writes a copy of the database at dsn to dest, which must not exist.
+// The copy is consistent even if the database is in use.
+func Backup(ctx context.Context, dsn string, dest string) error {
+	_, err := os.Stat(dest)
+	if err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	db, err := openPool(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "VACUUM INTO $1", dest)
+	return err
+}
+
+// Backup writes a consistent copy of the database to dest, which must not
+// exist, without blocking the writes
+func (db *sqliteRepo) Backup(ctx context.Context, dest string) error {
+	// every connection to :memory: opens a different database
+	if db.read == db.db {
+		_, err := db.db.ExecContext(ctx, "VACUUM INTO $1", dest)
+		return err
+	}
+	// the reader pool is query only, so the backup uses its own connection
+	return Backup(ctx, db.dsn, dest)
+}
+
+// Restore replaces the database file at path with the backup at src, after
+// checking the backup is not corrupted. Nothing may be using the database.
+func Restore(ctx context.Context, src string, path string) error {
+	err := checkIntegrity(ctx, src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+
+	// the backup is copied next to the database so the rename is atomic
+	tmp := path + ".restore"
+	err = os.Remove(tmp)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = Backup(ctx, src, tmp)
+	if err != nil {
+		return err
+	}
+
+	// the journal of the old database must not be applied to the restored one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		err = os.Remove(path + suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func checkIntegrity(ctx context.Context, path string) error {
+	_, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	err = db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package sqliterepo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.db")
+	backup := filepath.Join(dir, "backup.db")
+
+	db, err := Open(context.TODO(), path, "./migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveChat(context.TODO(), repo.Chat{ID: 1, Title: "antes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Backup(context.TODO(), path, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Backup(context.TODO(), path, backup)
+	if err == nil {
+		t.Fatal("backup over an existing file - want error, got nil")
+	}
+
+	err = db.SaveChat(context.TODO(), repo.Chat{ID: 2, Title: "depois"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	err = Restore(context.TODO(), backup, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(context.TODO(), path, "./migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.FindChat(context.TODO(), 1)
+	if err != nil {
+		t.Fatalf("chat in the backup - want: found, got: %v", err)
+	}
+	_, err = db.FindChat(context.TODO(), 2)
+	if err != repo.ErrNotFound {
+		t.Fatalf("chat after the backup - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+}
+
+func TestRestoreCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bot.db")
+	bad := filepath.Join(dir, "bad.db")
+
+	err := os.WriteFile(bad, []byte("not a database"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Restore(context.TODO(), bad, path)
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("corrupted backup was restored")
+	}
+}
+
+func TestBackupWhileWriting(t *testing.T) {
+	db := openFile(t)
+	backup := filepath.Join(t.TempDir(), "backup.db")
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 500; i++ {
+			err := db.SaveMessage(context.TODO(), repo.Message{ID: i, ChatID: 1, Text: "text", Date: time.Now()})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	err := db.Backup(context.TODO(), backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	err = checkIntegrity(context.TODO(), backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := open(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+
+	// the copy is a snapshot: messages are saved in order, so it has 1..n
+	var count, max int
+	err = copied.db.QueryRow("SELECT COUNT(*), COALESCE(MAX(id), 0) FROM message").Scan(&count, &max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != max {
+		t.Fatalf("backup is not a snapshot: %d messages, last id %d", count, max)
+	}
+}
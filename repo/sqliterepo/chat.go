@@ -2,102 +2,107 @@ package sqliterepo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 
 	"github.com/igoracmelo/euperturbot/repo"
 	"github.com/igoracmelo/euperturbot/util"
 )
 
-type rawChat struct {
-	ID         int64  `db:"id"`
-	Title      string `db:"title"`
-	EnableCAsk int    `db:"enable_cask"`
-}
-
 func (db sqliteRepo) SaveChat(ctx context.Context, chat repo.Chat) error {
-	rawChat := rawChat{
-		ID:         chat.ID,
-		Title:      chat.Title,
-		EnableCAsk: util.BoolToInt(chat.EnableCAsk),
-	}
-
 	_, err := db.db.NamedExecContext(ctx, `
 		INSERT INTO chat (
 			id,
-			title,
-			enable_cask
+			title
 		) VALUES (
 			:id,
-			:title,
-			:enable_cask
+			:title
 		)
 		ON CONFLICT DO UPDATE
 		SET
-			title           = :title,
-			enable_cask     = :enable_cask
-	`, rawChat)
+			title = :title
+	`, chat)
 
 	return err
 }
 
 func (db sqliteRepo) FindChat(ctx context.Context, chatID int64) (*repo.Chat, error) {
-	var c rawChat
+	var c repo.Chat
 
-	err := db.db.GetContext(ctx, &c, `
-		SELECT * FROM chat
+	err := db.read.GetContext(ctx, &c, `
+		SELECT id, title FROM chat
 		WHERE id = $1
 	`, chatID)
 
-	return &repo.Chat{
-		ID:         c.ID,
-		Title:      c.Title,
-		EnableCAsk: c.EnableCAsk == 1,
-	}, err
+	return &c, err
 }
 
-func (db sqliteRepo) ChatEnables(ctx context.Context, chatID int64, action string) (bool, error) {
-	var iAllow int
-	err := db.db.GetContext(ctx, &iAllow, `SELECT enable_`+action+` FROM chat WHERE id = $1`, chatID)
-	return iAllow == 1, err
+// ChatEnables tells if the feature is on in the chat, or its default if
+// the chat never changed it
+func (db sqliteRepo) ChatEnables(ctx context.Context, chatID int64, f repo.Feature) (bool, error) {
+	info, err := repo.LookupFeature(f)
+	if err != nil {
+		return false, err
+	}
+
+	var enabled int
+	err = db.read.GetContext(ctx, &enabled, `
+		SELECT enabled FROM chat_feature
+		WHERE chat_id = $1 AND feature = $2
+	`, chatID, f)
+	if errors.Is(err, sql.ErrNoRows) {
+		return info.Default, nil
+	}
+	return enabled == 1, err
 }
 
-func (db sqliteRepo) ChatEnable(ctx context.Context, chatID int64, action string) error {
-	res, err := db.db.ExecContext(ctx, `
-		UPDATE chat
-		SET enable_`+action+` = 1
-		WHERE id = $1
+// FindChatFeatures returns the state of every feature in the chat
+func (db sqliteRepo) FindChatFeatures(ctx context.Context, chatID int64) (map[repo.Feature]bool, error) {
+	rows := []struct {
+		Feature repo.Feature
+		Enabled int
+	}{}
+	err := db.read.SelectContext(ctx, &rows, `
+		SELECT feature, enabled FROM chat_feature
+		WHERE chat_id = $1
 	`, chatID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	n, err := res.RowsAffected()
-	if err != nil {
-		return err
+	features := map[repo.Feature]bool{}
+	for _, info := range repo.Features {
+		features[info.Feature] = info.Default
 	}
-
-	if n == 0 {
-		return repo.ErrNotFound
+	for _, r := range rows {
+		// features removed from the code are left behind
+		if _, ok := features[r.Feature]; ok {
+			features[r.Feature] = r.Enabled == 1
+		}
 	}
-	return err
+	return features, nil
 }
 
-func (db sqliteRepo) ChatDisable(ctx context.Context, chatID int64, action string) error {
-	res, err := db.db.ExecContext(ctx, `
-		UPDATE chat
-		SET enable_`+action+` = 0
-		WHERE id = $1
-	`, chatID)
+// SetChatFeature turns the feature on or off. The chat must be saved.
+func (db sqliteRepo) SetChatFeature(ctx context.Context, chatID int64, f repo.Feature, enabled bool) error {
+	_, err := repo.LookupFeature(f)
 	if err != nil {
 		return err
 	}
 
-	n, err := res.RowsAffected()
+	var exists bool
+	err = db.read.GetContext(ctx, &exists, `SELECT COUNT(*) > 0 FROM chat WHERE id = $1`, chatID)
 	if err != nil {
 		return err
 	}
-
-	if n == 0 {
+	if !exists {
 		return repo.ErrNotFound
 	}
+
+	_, err = db.db.ExecContext(ctx, `
+		INSERT INTO chat_feature (chat_id, feature, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO UPDATE SET enabled = $3
+	`, chatID, f, util.BoolToInt(enabled))
 	return err
 }
@@ -0,0 +1,132 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestChatFeatures(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	err := db.SaveChat(context.TODO(), repo.Chat{ID: 1, Title: "grupo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enables, err := db.ChatEnables(context.TODO(), 1, repo.FeatureAudio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enables {
+		t.Fatal("audio should be disabled by default")
+	}
+
+	err = db.SetChatFeature(context.TODO(), 1, repo.FeatureAudio, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enables, err = db.ChatEnables(context.TODO(), 1, repo.FeatureAudio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enables {
+		t.Fatal("audio should be enabled")
+	}
+
+	// saving the chat again keeps its features
+	err = db.SaveChat(context.TODO(), repo.Chat{ID: 1, Title: "grupo novo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	features, err := db.FindChatFeatures(context.TODO(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != len(repo.Features) {
+		t.Fatalf("features - want: %d, got: %d", len(repo.Features), len(features))
+	}
+	for f, enabled := range features {
+		if enabled != (f == repo.FeatureAudio) {
+			t.Fatalf("%s - want: %v, got: %v", f, f == repo.FeatureAudio, enabled)
+		}
+	}
+
+	err = db.SetChatFeature(context.TODO(), 2, repo.FeatureAudio, true)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("chat not saved - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	_, err = db.ChatEnables(context.TODO(), 1, repo.Feature("nope"))
+	if err == nil {
+		t.Fatal("want error for an unknown feature, got nil")
+	}
+}
+
+func TestMigrateChatFeatures(t *testing.T) {
+	db, _ := openTestFile(t)
+
+	// the migrations before chat_feature existed
+	old := fstest.MapFS{}
+	for version := 1; version <= 20; version++ {
+		name := fmt.Sprintf("%d.sql", version)
+		b, err := os.ReadFile("migrations/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old[name] = &fstest.MapFile{Data: b}
+	}
+	err := db.migrate(context.TODO(), old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.db.Exec(`
+		INSERT INTO chat (id, title, enable_cask, enable_audio, enable_sed) VALUES
+		(1, 'um', 1, 0, 1),
+		(2, 'dois', 0, 1, 0);
+		UPDATE chat SET enable_ask = 1 WHERE id = 2;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrate(context.TODO(), migrationsFS("./migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int64][]repo.Feature{
+		1: {repo.FeatureCAsk, repo.FeatureSed},
+		// transcriptions were enabled with /ask
+		2: {repo.FeatureAudio, repo.FeatureAsk, repo.FeatureTranscribe},
+	}
+	for chatID, enabled := range want {
+		features, err := db.FindChatFeatures(context.TODO(), chatID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		on := 0
+		for _, f := range enabled {
+			if !features[f] {
+				t.Fatalf("chat %d: %s should be enabled", chatID, f)
+			}
+		}
+		for _, v := range features {
+			if v {
+				on++
+			}
+		}
+		if on != len(enabled) {
+			t.Fatalf("chat %d: enabled features - want: %d, got: %d", chatID, len(enabled), on)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package sqliterepo
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+// maxEmbeddingAttempts is how many times the embedding of a message may fail
+// before FindMessagesWithoutEmbedding stops returning it
+const maxEmbeddingAttempts = 3
+
+func (db *sqliteRepo) FindMessagesWithoutEmbedding(ctx context.Context, count int) ([]repo.Message, error) {
+	msgs := []repo.Message{}
+	err := db.read.SelectContext(ctx, &msgs, `
+		SELECT m.*
+		FROM message m
+		LEFT JOIN message_embedding e
+		ON e.chat_id = m.chat_id AND e.message_id = m.id
+		LEFT JOIN message_embedding_failure f
+		ON f.chat_id = m.chat_id AND f.message_id = m.id
+		WHERE
+			e.message_id IS NULL AND
+			(f.attempts IS NULL OR f.attempts < $2) AND
+			(m.text <> '' OR m.caption <> '')
+		ORDER BY m.date DESC
+		LIMIT $1
+	`, count, maxEmbeddingAttempts)
+	return msgs, err
+}
+
+// SaveMessageEmbeddingFailure counts a failed attempt to embed the message
+func (db *sqliteRepo) SaveMessageEmbeddingFailure(ctx context.Context, chatID int64, msgID int) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO message_embedding_failure
+			(chat_id, message_id, attempts)
+		VALUES
+			($1, $2, 1)
+		ON CONFLICT DO UPDATE
+		SET attempts = attempts + 1
+	`, chatID, msgID)
+	return err
+}
+
+func (db *sqliteRepo) SaveMessageEmbedding(ctx context.Context, e repo.MessageEmbedding) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO message_embedding
+			(chat_id, message_id, model, vector)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT DO UPDATE
+		SET
+			model = $3,
+			vector = $4
+	`, e.ChatID, e.MessageID, e.Model, encodeVector(e.Vector))
+	return err
+}
+
+// FindSimilarMessages compares the vector against every embedding of the chat.
+// Brute force is fine for the amount of messages a chat has (see BenchmarkFindSimilarMessages).
+func (db *sqliteRepo) FindSimilarMessages(ctx context.Context, chatID int64, vector []float32, before time.Time, count int) ([]repo.Message, error) {
+	type scored struct {
+		msg   repo.Message
+		score float32
+	}
+
+	if count <= 0 {
+		return []repo.Message{}, nil
+	}
+
+	rows, err := db.read.QueryxContext(ctx, `
+		SELECT m.*, e.vector
+		FROM message_embedding e
+		JOIN message m
+		ON m.chat_id = e.chat_id AND m.id = e.message_id
+		WHERE
+			e.chat_id = $1 AND
+			m.date < $2
+	`, chatID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// top holds the best matches so far, best first
+	top := make([]scored, 0, count+1)
+
+	for rows.Next() {
+		var row struct {
+			repo.Message
+			Vector []byte `db:"vector"`
+		}
+		err = rows.StructScan(&row)
+		if err != nil {
+			return nil, err
+		}
+
+		score := util.CosineSimilarity(vector, decodeVector(row.Vector))
+		if len(top) == count && score <= top[len(top)-1].score {
+			continue
+		}
+
+		i := sort.Search(len(top), func(i int) bool {
+			return top[i].score < score
+		})
+		top = append(top, scored{})
+		copy(top[i+1:], top[i:])
+		top[i] = scored{row.Message, score}
+		if len(top) > count {
+			top = top[:count]
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]repo.Message, len(top))
+	for i := range top {
+		msgs[i] = top[i].msg
+	}
+	return msgs, nil
+}
+
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
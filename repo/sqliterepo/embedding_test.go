@@ -0,0 +1,188 @@
+package sqliterepo
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestMessageEmbedding(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	msgs := []repo.Message{
+		{ID: 1, ChatID: 1, Text: "a", Date: date},
+		{ID: 2, ChatID: 1, Text: "b", Date: date},
+		{ID: 3, ChatID: 1, Text: "c", Date: date},
+		{ID: 4, ChatID: 1, Text: "", Date: date},
+	}
+	for _, msg := range msgs {
+		err := db.SaveMessage(context.TODO(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// empty messages are not embedded
+	pending, err := db.FindMessagesWithoutEmbedding(context.TODO(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("pending - want: 3, got: %d", len(pending))
+	}
+
+	vectors := map[int][]float32{
+		1: {1, 0, 0},
+		2: {0.7, 0.7, 0},
+		3: {0, 0, 1},
+	}
+	for id, v := range vectors {
+		err = db.SaveMessageEmbedding(context.TODO(), repo.MessageEmbedding{
+			ChatID:    1,
+			MessageID: id,
+			Model:     "test",
+			Vector:    v,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err = db.FindMessagesWithoutEmbedding(context.TODO(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending - want: 0, got: %d", len(pending))
+	}
+
+	got, err := db.FindSimilarMessages(context.TODO(), 1, []float32{1, 0.1, 0}, date.Add(time.Second), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Fatalf("want: messages 1 and 2, got: %+v", got)
+	}
+
+	// only messages before the date
+	got, err = db.FindSimilarMessages(context.TODO(), 1, []float32{1, 0.1, 0}, date, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("want: no messages, got: %+v", got)
+	}
+
+	// editing the text invalidates the embedding
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: 1, Text: "edited", Date: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.FindMessagesWithoutEmbedding(context.TODO(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != 1 {
+		t.Fatalf("pending - want: message 1, got: %+v", pending)
+	}
+}
+
+func TestMessageEmbeddingFailure(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	err := db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: 1, Text: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxEmbeddingAttempts; i++ {
+		pending, err := db.FindMessagesWithoutEmbedding(context.TODO(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 1 {
+			t.Fatalf("pending after %d failures - want: 1, got: %d", i, len(pending))
+		}
+
+		err = db.SaveMessageEmbeddingFailure(context.TODO(), 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the indexer gives up on it
+	pending, err := db.FindMessagesWithoutEmbedding(context.TODO(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending - want: 0, got: %d", len(pending))
+	}
+
+	// and tries again after an edit
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: 1, Text: "edited"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.FindMessagesWithoutEmbedding(context.TODO(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("pending after edit - want: 1, got: %d", len(pending))
+	}
+}
+
+func BenchmarkFindSimilarMessages(b *testing.B) {
+	db, err := Open(context.TODO(), ":memory:", "./migrations")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	// roughly a year of an active chat, with text-embedding-ada-002 sized vectors
+	const msgCount = 10000
+	const dims = 1536
+
+	for i := 1; i <= msgCount; i++ {
+		err = db.SaveMessage(context.TODO(), repo.Message{ID: i, ChatID: 1, Text: "text"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = db.SaveMessageEmbedding(context.TODO(), repo.MessageEmbedding{
+			ChatID:    1,
+			MessageID: i,
+			Model:     "test",
+			Vector:    randomVector(dims),
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	query := randomVector(dims)
+	before := time.Now()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = db.FindSimilarMessages(context.TODO(), 1, query, before, 5)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func randomVector(size int) []float32 {
+	v := make([]float32, size)
+	for i := range v {
+		v[i] = rand.Float32()*2 - 1
+	}
+	return v
+}
@@ -2,16 +2,14 @@ package sqliterepo
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
 func (db *sqliteRepo) SaveMessage(ctx context.Context, msg repo.Message) error {
-	if len(msg.Text) > 500 {
-		msg.Text = msg.Text[:497] + "..."
-	}
-
+	// messages of users that opted out are never stored
 	_, err := db.db.ExecContext(context.TODO(), `
 		INSERT INTO message (
 			id,
@@ -20,10 +18,19 @@ func (db *sqliteRepo) SaveMessage(ctx context.Context, msg repo.Message) error {
 			text,
 			user_id,
 			user_name,
-			reply_to_message_id
+			reply_to_message_id,
+			content_type,
+			caption,
+			file_id,
+			sticker_emoji,
+			forward_origin
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		ON CONFLICT DO UPDATE SET text = $4
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		WHERE NOT EXISTS (
+			SELECT * FROM message_opt_out
+			WHERE chat_id = $2 AND user_id = $5
+		)
+		ON CONFLICT DO UPDATE SET text = $4, caption = $9
 	`,
 		msg.ID,
 		msg.ChatID,
@@ -32,22 +39,146 @@ func (db *sqliteRepo) SaveMessage(ctx context.Context, msg repo.Message) error {
 		msg.UserID,
 		msg.UserName,
 		msg.ReplyToMessageID,
+		msg.ContentType,
+		msg.Caption,
+		msg.FileID,
+		msg.StickerEmoji,
+		msg.ForwardOrigin,
 	)
 	return err
 }
 
 func (db *sqliteRepo) FindMessage(ctx context.Context, chatID int64, msgID int) (repo.Message, error) {
 	var msg repo.Message
-	err := db.db.GetContext(ctx, &msg, `
+	err := db.read.GetContext(ctx, &msg, `
 		SELECT * FROM message
 		WHERE chat_id = $1 AND id = $2
 	`, chatID, msgID)
 	return msg, err
 }
 
+// EditMessage replaces the text and caption of the message, keeping the previous ones as a revision
+func (db *sqliteRepo) EditMessage(ctx context.Context, chatID int64, msgID int, text string, caption string, date time.Time) error {
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old struct {
+		Text    string
+		Caption string
+	}
+	err = tx.GetContext(ctx, &old, `
+		SELECT text, caption FROM message
+		WHERE chat_id = $1 AND id = $2
+	`, chatID, msgID)
+	if err != nil {
+		return err
+	}
+
+	if old.Text == text && old.Caption == caption {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO message_revision
+			(chat_id, message_id, text, caption, date)
+		VALUES
+			($1, $2, $3, $4, $5)
+	`, chatID, msgID, old.Text, old.Caption, date)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE message
+		SET text = $3, caption = $4
+		WHERE chat_id = $1 AND id = $2
+	`, chatID, msgID, text, caption)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveTranscription sets the text of a saved voice message to its transcription
+func (db *sqliteRepo) SaveTranscription(ctx context.Context, chatID int64, msgID int, text string) error {
+	_, err := db.db.ExecContext(ctx, `
+		UPDATE message
+		SET text = $3
+		WHERE
+			chat_id = $1 AND
+			id = $2 AND
+			content_type = $4
+	`, chatID, msgID, text, repo.ContentTypeVoice)
+	if err != nil {
+		return err
+	}
+
+	// the transcription also describes the audio if it was saved in the library
+	_, err = db.db.ExecContext(ctx, `
+		UPDATE voice
+		SET label = $3
+		WHERE
+			chat_id = $1 AND
+			label = '' AND
+			file_id = (
+				SELECT file_id FROM message
+				WHERE chat_id = $1 AND id = $2
+			)
+	`, chatID, msgID, text)
+	return err
+}
+
+func (db *sqliteRepo) FindMessageRevisions(ctx context.Context, chatID int64, msgID int) ([]repo.MessageRevision, error) {
+	revs := []repo.MessageRevision{}
+	err := db.read.SelectContext(ctx, &revs, `
+		SELECT * FROM message_revision
+		WHERE chat_id = $1 AND message_id = $2
+		ORDER BY id
+	`, chatID, msgID)
+	return revs, err
+}
+
+// DeleteMessage deletes the message, its revisions and indexes. If withReplies is
+// true, it also deletes the replies to it, recursively.
+func (db *sqliteRepo) DeleteMessage(ctx context.Context, chatID int64, msgID int, withReplies bool) (int64, error) {
+	query := `
+		DELETE FROM message
+		WHERE chat_id = $1 AND id = $2
+	`
+	if withReplies {
+		query = `
+		WITH RECURSIVE replies(id) AS (
+			SELECT $2
+
+			UNION
+
+			SELECT m.id
+			FROM message m
+			INNER JOIN replies r
+			ON
+				m.chat_id = $1 AND
+				m.reply_to_message_id = r.id
+		)
+
+		DELETE FROM message
+		WHERE chat_id = $1 AND id IN (SELECT id FROM replies)
+		`
+	}
+
+	res, err := db.db.ExecContext(ctx, query, chatID, msgID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (db *sqliteRepo) FindMessagesBeforeDate(ctx context.Context, chatID int64, date time.Time, count int) ([]repo.Message, error) {
 	msgs := []repo.Message{}
-	err := db.db.SelectContext(context.TODO(), &msgs, `
+	err := db.read.SelectContext(context.TODO(), &msgs, `
 	 	SELECT * FROM (
 			SELECT *
 			FROM message
@@ -63,10 +194,25 @@ func (db *sqliteRepo) FindMessagesBeforeDate(ctx context.Context, chatID int64,
 	return msgs, err
 }
 
+func (db *sqliteRepo) FindMessagesBetweenDates(ctx context.Context, chatID int64, start time.Time, end time.Time) ([]repo.Message, error) {
+	msgs := []repo.Message{}
+	err := db.read.SelectContext(ctx, &msgs, `
+		SELECT *
+		FROM message
+		WHERE
+			chat_id = $1 AND
+			date >= $2 AND
+			date <= $3
+		ORDER BY date ASC, id ASC
+	`, chatID, start, end)
+
+	return msgs, err
+}
+
 func (db *sqliteRepo) FindMessageThread(ctx context.Context, chatID int64, msgID int) ([]repo.Message, error) {
 	var msgs []repo.Message
 
-	err := db.db.SelectContext(ctx, &msgs, `
+	err := db.read.SelectContext(ctx, &msgs, `
 	WITH RECURSIVE replies(id, reply_to_message_id) AS (
 		SELECT id, reply_to_message_id
 		FROM message
@@ -91,3 +237,39 @@ func (db *sqliteRepo) FindMessageThread(ctx context.Context, chatID int64, msgID
 
 	return msgs, err
 }
+
+func (db *sqliteRepo) SearchMessages(ctx context.Context, chatID int64, terms string, limit int, offset int) ([]repo.MessageSearchResult, error) {
+	results := []repo.MessageSearchResult{}
+
+	query := ftsQuery(terms)
+	if query == "" {
+		return results, nil
+	}
+
+	err := db.read.SelectContext(ctx, &results, `
+		SELECT
+			m.*,
+			snippet(message_fts, 0, $1, $2, '…', 16) AS snippet
+		FROM message_fts f
+		JOIN message_key k ON k.id = f.rowid
+		JOIN message m ON m.chat_id = k.chat_id AND m.id = k.message_id
+		WHERE
+			message_fts MATCH $3 AND
+			k.chat_id = $4
+		ORDER BY rank
+		LIMIT $5 OFFSET $6
+	`, repo.SnippetMatchStart, repo.SnippetMatchEnd, query, chatID, limit, offset)
+
+	return results, err
+}
+
+// ftsQuery turns user input into a FTS5 query matching all the terms by prefix.
+// Every term is quoted, so FTS5 operators typed by users are searched as text.
+func ftsQuery(terms string) string {
+	quoted := []string{}
+	for _, term := range strings.Fields(terms) {
+		term = strings.ReplaceAll(term, `"`, `""`)
+		quoted = append(quoted, `"`+term+`"*`)
+	}
+	return strings.Join(quoted, " ")
+}
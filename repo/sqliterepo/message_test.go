@@ -2,6 +2,8 @@ package sqliterepo
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,6 +39,70 @@ func TestSaveAndFindMessage(t *testing.T) {
 	}
 }
 
+func TestSaveMediaMessage(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	want := repo.Message{
+		ID:            1,
+		ChatID:        1,
+		UserID:        1,
+		UserName:      "name",
+		ContentType:   repo.ContentTypePhoto,
+		Caption:       "olha essa foto",
+		FileID:        "file-id",
+		StickerEmoji:  "",
+		ForwardOrigin: "someone",
+	}
+
+	err := db.SaveMessage(context.TODO(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindMessage(context.TODO(), want.ChatID, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+
+	// captions are searchable
+	results, err := db.SearchMessages(context.TODO(), want.ChatID, "foto", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("search results - want: 1, got: %d", len(results))
+	}
+}
+
+func TestSaveLongMessage(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	// text is stored as is, even if long and multibyte
+	want := repo.Message{
+		ID:     1,
+		ChatID: 1,
+		Text:   strings.Repeat("ção ", 1000),
+	}
+
+	err := db.SaveMessage(context.TODO(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindMessage(context.TODO(), want.ChatID, want.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != want.Text {
+		t.Fatalf("text - want: len %d, got: len %d", len(want.Text), len(got.Text))
+	}
+}
+
 func TestFindMessageThread(t *testing.T) {
 	db := newDB(t)
 	defer db.Close()
@@ -91,3 +157,271 @@ func TestFindMessageThread(t *testing.T) {
 		}
 	}
 }
+
+func TestFindMessagesBetweenDates(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	const chatID = 1
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	msgs := []repo.Message{
+		{ID: 1, ChatID: chatID, Text: "before", Date: start.Add(-time.Minute)},
+		{ID: 2, ChatID: chatID, Text: "start", Date: start},
+		{ID: 3, ChatID: chatID, Text: "middle", Date: start.Add(time.Hour)},
+		{ID: 4, ChatID: chatID, Text: "end", Date: start.Add(2 * time.Hour)},
+		{ID: 5, ChatID: chatID, Text: "after", Date: start.Add(3 * time.Hour)},
+		{ID: 6, ChatID: 2, Text: "other chat", Date: start.Add(time.Hour)},
+	}
+
+	for _, msg := range msgs {
+		err := db.SaveMessage(context.TODO(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.FindMessagesBetweenDates(context.TODO(), chatID, start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"start", "middle", "end"}
+	if len(got) != len(want) {
+		t.Fatalf("want: len %d, got: len %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Text != want[i] {
+			t.Errorf("msg %d - want: %s, got: %s", i, want[i], got[i].Text)
+		}
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	msgs := []repo.Message{
+		{ID: 1, ChatID: 1, Text: "bora jogar brawlhalla hoje", UserName: "a"},
+		{ID: 2, ChatID: 1, Text: "alguém viu a atualização do jogo?", UserName: "b"},
+		{ID: 3, ChatID: 1, Text: "nada a ver", UserName: "c"},
+		{ID: 4, ChatID: 2, Text: "brawlhalla em outro chat", UserName: "d"},
+	}
+
+	for _, msg := range msgs {
+		err := db.SaveMessage(context.TODO(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// prefix match
+	got, err := db.SearchMessages(context.TODO(), 1, "brawl", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("want: message 1, got: %+v", got)
+	}
+	wantSnippet := "bora jogar " + repo.SnippetMatchStart + "brawlhalla" + repo.SnippetMatchEnd + " hoje"
+	if got[0].Snippet != wantSnippet {
+		t.Fatalf("snippet - want: %q, got: %q", wantSnippet, got[0].Snippet)
+	}
+
+	// diacritics are ignored
+	got, err = db.SearchMessages(context.TODO(), 1, "atualizacao", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 2 {
+		t.Fatalf("want: message 2, got: %+v", got)
+	}
+
+	// fts syntax is treated as text
+	_, err = db.SearchMessages(context.TODO(), 1, `"jog* OR (`, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// edited text is reindexed
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 3, ChatID: 1, Text: "agora tem brawlhalla"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.SearchMessages(context.TODO(), 1, "brawlhalla", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want: 2 results, got: %d", len(got))
+	}
+
+	// pagination
+	got, err = db.SearchMessages(context.TODO(), 1, "brawlhalla", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("want: 1 result, got: %d", len(got))
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	msg := repo.Message{ID: 1, ChatID: 1, Text: "first"}
+	err := db.SaveMessage(context.TODO(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	editDate := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, txt := range []string{"second", "second", "third"} {
+		err = db.EditMessage(context.TODO(), msg.ChatID, msg.ID, txt, "", editDate)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.FindMessage(context.TODO(), msg.ChatID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "third" {
+		t.Fatalf("text - want: third, got: %s", got.Text)
+	}
+
+	// editing to the same text doesn't create a revision
+	revs, err := db.FindMessageRevisions(context.TODO(), msg.ChatID, msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first", "second"}
+	if len(revs) != len(want) {
+		t.Fatalf("revisions - want: %d, got: %d", len(want), len(revs))
+	}
+	for i := range want {
+		if revs[i].Text != want[i] {
+			t.Errorf("revision %d - want: %s, got: %s", i, want[i], revs[i].Text)
+		}
+	}
+
+	// unknown messages aren't created
+	err = db.EditMessage(context.TODO(), msg.ChatID, 2, "text", "", editDate)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("err - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	// 1 <- 2 <- 3, 1 <- 4, 5
+	msgs := []repo.Message{
+		{ID: 1, ChatID: 1, Text: "a"},
+		{ID: 2, ChatID: 1, Text: "b", ReplyToMessageID: 1},
+		{ID: 3, ChatID: 1, Text: "c", ReplyToMessageID: 2},
+		{ID: 4, ChatID: 1, Text: "d", ReplyToMessageID: 1},
+		{ID: 5, ChatID: 1, Text: "e"},
+		{ID: 2, ChatID: 2, Text: "other chat", ReplyToMessageID: 1},
+	}
+	for _, msg := range msgs {
+		err := db.SaveMessage(context.TODO(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := db.EditMessage(context.TODO(), 1, 5, "edited", "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.DeleteMessage(context.TODO(), 1, 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("deleted - want: 1, got: %d", n)
+	}
+
+	revs, err := db.FindMessageRevisions(context.TODO(), 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 0 {
+		t.Fatalf("revisions - want: 0, got: %d", len(revs))
+	}
+
+	results, err := db.SearchMessages(context.TODO(), 1, "edited", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("search results - want: 0, got: %d", len(results))
+	}
+
+	n, err = db.DeleteMessage(context.TODO(), 1, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("deleted - want: 4, got: %d", n)
+	}
+
+	_, err = db.FindMessage(context.TODO(), 2, 2)
+	if err != nil {
+		t.Fatalf("message from other chat must not be deleted: %v", err)
+	}
+}
+
+func TestSaveTranscription(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	msgs := []repo.Message{
+		{ID: 1, ChatID: 1, ContentType: repo.ContentTypeVoice, FileID: "voice"},
+		{ID: 2, ChatID: 1, ContentType: repo.ContentTypeText, Text: "text"},
+	}
+	for _, msg := range msgs {
+		err := db.SaveMessage(context.TODO(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, msg := range msgs {
+		err := db.SaveTranscription(context.TODO(), msg.ChatID, msg.ID, "transcription")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.FindMessage(context.TODO(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "transcription" {
+		t.Fatalf("voice text - want: transcription, got: %s", got.Text)
+	}
+
+	// only voice messages are transcribed
+	got, err = db.FindMessage(context.TODO(), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "text" {
+		t.Fatalf("text - want: text, got: %s", got.Text)
+	}
+
+	// transcriptions are searchable
+	results, err := db.SearchMessages(context.TODO(), 1, "transcription", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("search results - want: 1, got: %d", len(results))
+	}
+}
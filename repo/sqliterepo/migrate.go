@@ -0,0 +1,258 @@
+package sqliterepo
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// Migration is one of the N.sql files, applied in order
+type Migration struct {
+	Version int
+	Name    string
+	// Checksum is the sha256 of the file
+	Checksum string
+	Applied  bool
+	// Edited means the file changed after it was applied
+	Edited bool
+
+	sql string
+}
+
+// migrationsFS returns the migrations in dir, or the embedded ones if dir is empty
+func migrationsFS(dir string) fs.FS {
+	if dir == "" {
+		sub, err := fs.Sub(embeddedMigrations, "migrations")
+		if err != nil {
+			panic(err)
+		}
+		return sub
+	}
+	return os.DirFS(dir)
+}
+
+// loadMigrations reads 1.sql, 2.sql and so on until one is missing
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	migrations := []Migration{}
+	for version := 1; ; version++ {
+		name := fmt.Sprintf("%d.sql", version)
+		b, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return migrations, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(b)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     name,
+			Checksum: hex.EncodeToString(sum[:]),
+			sql:      string(b),
+		})
+	}
+}
+
+// status marks the migrations applied to the database and the edited ones
+func (db *sqliteRepo) status(ctx context.Context, migrations []Migration) (version int, err error) {
+	err = db.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("database version %d is newer than the latest migration, %d", version, len(migrations))
+	}
+
+	var exists bool
+	err = db.db.GetContext(ctx, &exists, `
+		SELECT COUNT(*) > 0 FROM sqlite_master
+		WHERE type = 'table' AND name = 'schema_migrations'
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	checksums := map[int]string{}
+	if exists {
+		rows := []struct {
+			Version  int
+			Checksum string
+		}{}
+		err = db.db.SelectContext(ctx, &rows, "SELECT version, checksum FROM schema_migrations")
+		if err != nil {
+			return 0, err
+		}
+		for _, r := range rows {
+			checksums[r.Version] = r.Checksum
+		}
+	}
+
+	for i := range migrations {
+		m := &migrations[i]
+		m.Applied = m.Version <= version
+		// migrations applied before checksums were recorded are trusted
+		if sum, ok := checksums[m.Version]; ok && sum != m.Checksum {
+			m.Edited = true
+		}
+	}
+
+	return version, nil
+}
+
+// Status returns the migrations, telling which are applied to the database,
+// without changing it
+func Status(ctx context.Context, dsn string, dir string) ([]Migration, error) {
+	db, err := open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	migrations, err := loadMigrations(migrationsFS(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.status(ctx, migrations)
+	return migrations, err
+}
+
+// OpenCurrent opens the database without migrating it, for the tools that
+// must not change it. It fails if the database is missing or has pending
+// migrations, since the queries expect the latest schema.
+func OpenCurrent(ctx context.Context, dsn string, dir string) (repo.Repo, error) {
+	if dsn != ":memory:" {
+		// opening a missing file would create an empty database
+		_, err := os.Stat(dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(migrationsFS(dir))
+	if err == nil {
+		db.Version, err = db.status(ctx, migrations)
+	}
+	if err == nil && db.Version < len(migrations) {
+		err = fmt.Errorf("the database has %d pending migrations. run migrate up first", len(migrations)-db.Version)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *sqliteRepo) migrate(ctx context.Context, fsys fs.FS) error {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	version, err := db.status(ctx, migrations)
+	if err != nil {
+		return err
+	}
+	db.Version = version
+
+	edited := []string{}
+	for _, m := range migrations {
+		if m.Edited {
+			edited = append(edited, m.Name)
+		}
+	}
+	if len(edited) > 0 {
+		return fmt.Errorf("migrations edited after being applied: %s", strings.Join(edited, ", "))
+	}
+
+	_, err = db.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			checksum TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if !m.Applied {
+			err = db.applyMigration(ctx, m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", m.Name, err)
+			}
+			db.Version = m.Version
+			continue
+		}
+
+		_, err = db.db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO schema_migrations (version, checksum, applied_at)
+			VALUES ($1, $2, $3)
+		`, m.Version, m.Checksum, db.now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs the migration and bumps the version in the same
+// transaction, so a crash never leaves one without the other
+func (db *sqliteRepo) applyMigration(ctx context.Context, m Migration) error {
+	log.Printf("RUN %s", m.Name)
+	start := time.Now()
+
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, m.sql)
+	if err != nil {
+		return err
+	}
+
+	// PRAGMA doesn't support $1, but it is safe to use fmt.Sprintf here
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.Version))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR REPLACE INTO schema_migrations (version, checksum, applied_at)
+		VALUES ($1, $2, $3)
+	`, m.Version, m.Checksum, db.now())
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SUCCESS in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
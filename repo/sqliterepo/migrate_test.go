@@ -0,0 +1,217 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func openTestFile(t *testing.T) (*sqliteRepo, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bot.db")
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db, path
+}
+
+func userVersion(t *testing.T, db *sqliteRepo) int {
+	t.Helper()
+
+	var version int
+	err := db.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestMigrateEmbedded(t *testing.T) {
+	_db, err := Open(context.TODO(), ":memory:", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := _db.(*sqliteRepo)
+
+	var count int
+	err = db.db.Get(&count, "SELECT COUNT(*) FROM schema_migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != db.Version {
+		t.Fatalf("recorded migrations - want: %d, got: %d", db.Version, count)
+	}
+}
+
+func TestMigrateIsTransactional(t *testing.T) {
+	db, _ := openTestFile(t)
+
+	fsys := fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE a (x INTEGER);")},
+		"2.sql": {Data: []byte("CREATE TABLE b (x INTEGER); INSERT INTO nope VALUES (1);")},
+	}
+	err := db.migrate(context.TODO(), fsys)
+	if err == nil || !strings.Contains(err.Error(), "2.sql") {
+		t.Fatalf("want error in 2.sql, got: %v", err)
+	}
+
+	if v := userVersion(t, db); v != 1 {
+		t.Fatalf("version - want: %d, got: %d", 1, v)
+	}
+
+	var tables int
+	err = db.db.Get(&tables, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'b'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatal("table of the failed migration was created")
+	}
+
+	// fixing the migration applies it
+	fsys["2.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b (x INTEGER);")}
+	err = db.migrate(context.TODO(), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := userVersion(t, db); v != 2 {
+		t.Fatalf("version - want: %d, got: %d", 2, v)
+	}
+}
+
+func TestMigrateEdited(t *testing.T) {
+	db, path := openTestFile(t)
+
+	err := db.migrate(context.TODO(), fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE a (x INTEGER);")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE a (x INTEGER, y TEXT);")},
+		"2.sql": {Data: []byte("CREATE TABLE b (x INTEGER);")},
+	}
+	err = db.migrate(context.TODO(), edited)
+	if err == nil || !strings.Contains(err.Error(), "1.sql") {
+		t.Fatalf("want error about 1.sql, got: %v", err)
+	}
+	if v := userVersion(t, db); v != 1 {
+		t.Fatalf("version - want: %d, got: %d", 1, v)
+	}
+
+	// Status doesn't need a directory, but this one tells about the edit
+	dir := t.TempDir()
+	for name, f := range edited {
+		writeTestFile(t, filepath.Join(dir, name), string(f.Data))
+	}
+	migrations, err := Status(context.TODO(), path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("migrations - want: %d, got: %d", 2, len(migrations))
+	}
+	if !migrations[0].Applied || !migrations[0].Edited {
+		t.Fatalf("1.sql - want: applied and edited, got: %+v", migrations[0])
+	}
+	if migrations[1].Applied || migrations[1].Edited {
+		t.Fatalf("2.sql - want: pending, got: %+v", migrations[1])
+	}
+}
+
+func TestMigrateRecordsOldMigrations(t *testing.T) {
+	db, _ := openTestFile(t)
+
+	// applied before checksums were recorded
+	_, err := db.db.Exec("CREATE TABLE a (x INTEGER); PRAGMA user_version = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrate(context.TODO(), fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE a (x INTEGER);")},
+		"2.sql": {Data: []byte("CREATE TABLE b (x INTEGER);")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []int
+	err = db.db.Select(&versions, "SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("recorded versions - want: [1 2], got: %v", versions)
+	}
+}
+
+func TestMigrateNewerDatabase(t *testing.T) {
+	db, _ := openTestFile(t)
+
+	_, err := db.db.Exec("PRAGMA user_version = 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrate(context.TODO(), fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE a (x INTEGER);")},
+	})
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenCurrent(t *testing.T) {
+	db, path := openTestFile(t)
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "1.sql"), "CREATE TABLE a (x INTEGER);")
+	writeTestFile(t, filepath.Join(dir, "2.sql"), "CREATE TABLE b (x INTEGER);")
+
+	err := db.migrate(context.TODO(), fstest.MapFS{
+		"1.sql": {Data: []byte("CREATE TABLE a (x INTEGER);")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenCurrent(context.TODO(), path, dir)
+	if err == nil || !strings.Contains(err.Error(), "1 pending migrations") {
+		t.Fatalf("want error about the pending migration, got: %v", err)
+	}
+	if v := userVersion(t, db); v != 1 {
+		t.Fatalf("version - want: %d, got: %d", 1, v)
+	}
+
+	_, err = OpenCurrent(context.TODO(), filepath.Join(dir, "nope.db"), dir)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("missing database - want: %v, got: %v", os.ErrNotExist, err)
+	}
+
+	os.Remove(filepath.Join(dir, "2.sql"))
+	current, err := OpenCurrent(context.TODO(), path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Close()
+}
@@ -0,0 +1,28 @@
+-- full-text index over message.text, kept in sync by triggers.
+-- message has no INTEGER PRIMARY KEY, so its rowid may change on VACUUM.
+-- because of that, messages are referenced by (chat_id, message_id) instead of rowid.
+CREATE VIRTUAL TABLE message_fts USING fts5(
+    text,
+    chat_id UNINDEXED,
+    message_id UNINDEXED,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER message_fts_insert AFTER INSERT ON message BEGIN
+    INSERT INTO message_fts (text, chat_id, message_id)
+    VALUES (new.text, new.chat_id, new.id);
+END;
+
+CREATE TRIGGER message_fts_delete AFTER DELETE ON message BEGIN
+    DELETE FROM message_fts
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
+
+CREATE TRIGGER message_fts_update AFTER UPDATE OF text ON message BEGIN
+    UPDATE message_fts
+    SET text = new.text
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
+
+INSERT INTO message_fts (text, chat_id, message_id)
+SELECT text, chat_id, id FROM message;
@@ -0,0 +1,20 @@
+-- embedding vectors of messages, for semantic search.
+-- vector is a little endian float32 array.
+CREATE TABLE message_embedding (
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    model TEXT NOT NULL,
+    vector BLOB NOT NULL,
+    PRIMARY KEY (chat_id, message_id)
+);
+
+CREATE TRIGGER message_embedding_delete AFTER DELETE ON message BEGIN
+    DELETE FROM message_embedding
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
+
+-- the embedding is stale after the text changes. the indexer computes it again.
+CREATE TRIGGER message_embedding_update AFTER UPDATE OF text ON message BEGIN
+    DELETE FROM message_embedding
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
@@ -0,0 +1,16 @@
+-- previous versions of edited messages.
+-- date is when the text was replaced by the next version.
+CREATE TABLE message_revision (
+    id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    date TIMESTAMP NOT NULL
+);
+
+CREATE INDEX message_revision_message ON message_revision (chat_id, message_id);
+
+CREATE TRIGGER message_revision_delete AFTER DELETE ON message BEGIN
+    DELETE FROM message_revision
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
@@ -0,0 +1,6 @@
+-- users that don't want their messages saved in a chat
+CREATE TABLE message_opt_out (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, user_id)
+);
@@ -0,0 +1,63 @@
+-- how long messages are kept in each chat. 0 means no limit.
+CREATE TABLE retention_policy (
+    chat_id INTEGER PRIMARY KEY,
+    max_age_seconds INTEGER NOT NULL DEFAULT 0,
+    max_rows INTEGER NOT NULL DEFAULT 0
+);
+
+-- message_fts triggers looked rows up by its UNINDEXED columns, which scans the
+-- whole index for every deleted message. that makes pruning quadratic.
+-- message_key gives every message a stable id (it survives VACUUM, unlike the
+-- implicit rowid of message), used as the rowid of message_fts.
+DROP TRIGGER message_fts_insert;
+DROP TRIGGER message_fts_delete;
+DROP TRIGGER message_fts_update;
+DROP TABLE message_fts;
+
+CREATE TABLE message_key (
+    id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    UNIQUE (chat_id, message_id)
+);
+
+CREATE VIRTUAL TABLE message_fts USING fts5(
+    text,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER message_fts_insert AFTER INSERT ON message BEGIN
+    INSERT INTO message_key (chat_id, message_id)
+    VALUES (new.chat_id, new.id);
+
+    INSERT INTO message_fts (rowid, text)
+    VALUES (last_insert_rowid(), new.text);
+END;
+
+CREATE TRIGGER message_fts_delete AFTER DELETE ON message BEGIN
+    DELETE FROM message_fts
+    WHERE rowid = (
+        SELECT id FROM message_key
+        WHERE chat_id = old.chat_id AND message_id = old.id
+    );
+
+    DELETE FROM message_key
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
+
+CREATE TRIGGER message_fts_update AFTER UPDATE OF text ON message BEGIN
+    UPDATE message_fts
+    SET text = new.text
+    WHERE rowid = (
+        SELECT id FROM message_key
+        WHERE chat_id = old.chat_id AND message_id = old.id
+    );
+END;
+
+INSERT INTO message_key (chat_id, message_id)
+SELECT chat_id, id FROM message;
+
+INSERT INTO message_fts (rowid, text)
+SELECT k.id, m.text
+FROM message m
+JOIN message_key k ON k.chat_id = m.chat_id AND k.message_id = m.id;
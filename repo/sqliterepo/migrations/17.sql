@@ -0,0 +1,36 @@
+-- media messages. content_type is one of text, photo, sticker, voice or document.
+ALTER TABLE message ADD COLUMN content_type TEXT NOT NULL DEFAULT 'text';
+ALTER TABLE message ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+ALTER TABLE message ADD COLUMN file_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE message ADD COLUMN sticker_emoji TEXT NOT NULL DEFAULT '';
+ALTER TABLE message ADD COLUMN forward_origin TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE message_revision ADD COLUMN caption TEXT NOT NULL DEFAULT '';
+
+-- captions are searchable too
+DROP TRIGGER message_fts_insert;
+DROP TRIGGER message_fts_update;
+
+CREATE TRIGGER message_fts_insert AFTER INSERT ON message BEGIN
+    INSERT INTO message_key (chat_id, message_id)
+    VALUES (new.chat_id, new.id);
+
+    INSERT INTO message_fts (rowid, text)
+    VALUES (last_insert_rowid(), trim(new.text || ' ' || new.caption));
+END;
+
+CREATE TRIGGER message_fts_update AFTER UPDATE OF text, caption ON message BEGIN
+    UPDATE message_fts
+    SET text = trim(new.text || ' ' || new.caption)
+    WHERE rowid = (
+        SELECT id FROM message_key
+        WHERE chat_id = old.chat_id AND message_id = old.id
+    );
+END;
+
+DROP TRIGGER message_embedding_update;
+
+CREATE TRIGGER message_embedding_update AFTER UPDATE OF text, caption ON message BEGIN
+    DELETE FROM message_embedding
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
@@ -0,0 +1,34 @@
+-- voices were keyed by file_id across all chats. Now each chat has its own
+-- library, where audios have a unique name and optional tags.
+CREATE TABLE voice_new (
+    id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    file_id TEXT NOT NULL,
+    -- who sent the audio
+    user_id INTEGER NOT NULL,
+    -- who saved the audio in the library
+    saved_by INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    UNIQUE (chat_id, name),
+    UNIQUE (chat_id, file_id)
+);
+
+INSERT INTO voice_new
+    (chat_id, file_id, user_id, saved_by, name)
+SELECT chat_id, file_id, user_id, user_id, 'audio' || rowid
+FROM voice;
+
+DROP TABLE voice;
+ALTER TABLE voice_new RENAME TO voice;
+
+CREATE TABLE voice_tag (
+    voice_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (voice_id, tag)
+);
+
+CREATE INDEX voice_tag_tag ON voice_tag (tag);
+
+CREATE TRIGGER voice_tag_delete AFTER DELETE ON voice BEGIN
+    DELETE FROM voice_tag WHERE voice_id = old.id;
+END;
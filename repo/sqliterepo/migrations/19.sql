@@ -0,0 +1,11 @@
+-- inline mode searches the voices by name, tags, label and who saved them.
+-- label is a free description of the audio, e.g. its transcription.
+ALTER TABLE voice ADD COLUMN label TEXT NOT NULL DEFAULT '';
+ALTER TABLE voice ADD COLUMN saved_by_name TEXT NOT NULL DEFAULT '';
+
+-- inline queries don't carry the chat, so each user chooses which chat's
+-- library they search
+CREATE TABLE inline_chat (
+    user_id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL
+);
@@ -0,0 +1,5 @@
+-- indexes of the hot queries: the context of a chat is read by date, the
+-- subscribers are found by topic and the votes by the poll's result message
+CREATE INDEX IF NOT EXISTS message_chat_date ON message (chat_id, date);
+CREATE INDEX IF NOT EXISTS user_topic_chat_topic ON user_topic (chat_id, topic);
+CREATE INDEX IF NOT EXISTS poll_result_message ON poll (result_message_id);
@@ -0,0 +1,21 @@
+-- the switches of each chat. a missing row means the default of the feature,
+-- so new switches don't need migrations.
+CREATE TABLE chat_feature (
+    chat_id INTEGER NOT NULL REFERENCES chat (id) ON DELETE CASCADE,
+    feature TEXT NOT NULL,
+    enabled INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, feature)
+);
+
+INSERT INTO chat_feature (chat_id, feature, enabled)
+SELECT id, 'cask', enable_cask FROM chat
+UNION ALL SELECT id, 'sed', enable_sed FROM chat
+UNION ALL SELECT id, 'audio', enable_audio FROM chat
+UNION ALL SELECT id, 'create_topics', enable_create_topics FROM chat
+UNION ALL SELECT id, 'ask', enable_ask FROM chat;
+
+ALTER TABLE chat DROP COLUMN enable_cask;
+ALTER TABLE chat DROP COLUMN enable_sed;
+ALTER TABLE chat DROP COLUMN enable_audio;
+ALTER TABLE chat DROP COLUMN enable_create_topics;
+ALTER TABLE chat DROP COLUMN enable_ask;
@@ -0,0 +1,19 @@
+-- messages whose embedding failed. after a few attempts the indexer gives up on
+-- them, so a message the API always rejects doesn't block the rest.
+CREATE TABLE message_embedding_failure (
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    attempts INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, message_id)
+);
+
+CREATE TRIGGER message_embedding_failure_delete AFTER DELETE ON message BEGIN
+    DELETE FROM message_embedding_failure
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
+
+-- the edited text may not fail, so it is tried again
+CREATE TRIGGER message_embedding_failure_update AFTER UPDATE OF text, caption ON message BEGIN
+    DELETE FROM message_embedding_failure
+    WHERE chat_id = old.chat_id AND message_id = old.id;
+END;
@@ -0,0 +1,4 @@
+-- /transcrever had the switch of /ask. the chats that enabled it keep it.
+INSERT INTO chat_feature (chat_id, feature, enabled)
+SELECT chat_id, 'transcribe', enabled FROM chat_feature
+WHERE feature = 'ask';
@@ -16,9 +16,15 @@ func (db *sqliteRepo) SavePoll(p repo.Poll) error {
 	return err
 }
 
+func (db *sqliteRepo) FindPoll(id string) (*repo.Poll, error) {
+	var p repo.Poll
+	err := db.read.GetContext(context.TODO(), &p, `SELECT * FROM poll WHERE id = $1`, id)
+	return &p, err
+}
+
 func (db *sqliteRepo) FindPollByMessage(msgID int) (*repo.Poll, error) {
 	var p repo.Poll
-	err := db.db.GetContext(context.TODO(), &p, `SELECT * FROM poll WHERE result_message_id = $1`, msgID)
+	err := db.read.GetContext(context.TODO(), &p, `SELECT * FROM poll WHERE result_message_id = $1`, msgID)
 	return &p, err
 }
 
@@ -43,7 +49,7 @@ func (db *sqliteRepo) DeletePollVote(pollID string, userID int64) error {
 
 func (db *sqliteRepo) FindPollVote(pollID string, userID int64) (*repo.PollVote, error) {
 	var v repo.PollVote
-	err := db.db.GetContext(context.TODO(), &v, `
+	err := db.read.GetContext(context.TODO(), &v, `
 		SELECT pv.* FROM poll_vote pv
 		JOIN user_topic ut ON ut.user_id = $2
 		WHERE pv.poll_id = $1 AND pv.user_id = $2
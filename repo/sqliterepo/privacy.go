@@ -0,0 +1,124 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func (db *sqliteRepo) SetMessageOptOut(ctx context.Context, chatID int64, userID int64, optOut bool) error {
+	query := `
+		DELETE FROM message_opt_out
+		WHERE chat_id = $1 AND user_id = $2
+	`
+	if optOut {
+		query = `
+		INSERT INTO message_opt_out
+			(chat_id, user_id)
+		VALUES
+			($1, $2)
+		ON CONFLICT DO NOTHING
+		`
+	}
+
+	_, err := db.db.ExecContext(ctx, query, chatID, userID)
+	return err
+}
+
+func (db *sqliteRepo) FindMessageOptOuts(ctx context.Context, chatID int64) ([]int64, error) {
+	userIDs := []int64{}
+	err := db.read.SelectContext(ctx, &userIDs, `
+		SELECT user_id FROM message_opt_out
+		WHERE chat_id = $1
+	`, chatID)
+	return userIDs, err
+}
+
+func (db *sqliteRepo) DeleteUserMessages(ctx context.Context, chatID int64, userID int64) (int64, error) {
+	res, err := db.db.ExecContext(ctx, `
+		DELETE FROM message
+		WHERE chat_id = $1 AND user_id = $2
+	`, chatID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (db *sqliteRepo) FindUserData(ctx context.Context, userID int64) (*repo.UserData, error) {
+	data := &repo.UserData{
+		Topics:           []repo.UserTopic{},
+		PollVotes:        []repo.PollVote{},
+		Messages:         []repo.Message{},
+		MessageRevisions: []repo.MessageRevision{},
+		Voices:           []repo.Voice{},
+		MessageOptOuts:   []int64{},
+	}
+
+	user, err := db.FindUser(userID)
+	if err == nil {
+		data.User = user
+	} else if !errors.Is(err, repo.ErrNotFound) {
+		return nil, err
+	}
+
+	err = db.read.SelectContext(ctx, &data.Topics, `
+		SELECT * FROM user_topic
+		WHERE user_id = $1
+		ORDER BY chat_id, topic
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.read.SelectContext(ctx, &data.PollVotes, `
+		SELECT * FROM poll_vote
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.read.SelectContext(ctx, &data.Messages, `
+		SELECT * FROM message
+		WHERE user_id = $1
+		ORDER BY chat_id, date
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// revisions keep who wrote them through their message
+	err = db.read.SelectContext(ctx, &data.MessageRevisions, `
+		SELECT r.* FROM message_revision r
+		JOIN message m ON m.chat_id = r.chat_id AND m.id = r.message_id
+		WHERE m.user_id = $1
+		ORDER BY r.chat_id, r.message_id, r.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	voices := []rawVoice{}
+	err = db.read.SelectContext(ctx, &voices, selectVoice+`
+		WHERE user_id = $1 OR saved_by = $1
+		ORDER BY chat_id, name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range voices {
+		data.Voices = append(data.Voices, v.voice())
+	}
+
+	err = db.read.SelectContext(ctx, &data.MessageOptOuts, `
+		SELECT chat_id FROM message_opt_out
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,141 @@
+package sqliterepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestMessageOptOut(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	const chatID = 1
+	const userID = 10
+
+	err := db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: chatID, UserID: userID, Text: "before"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SetMessageOptOut(context.TODO(), chatID, userID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.DeleteUserMessages(context.TODO(), chatID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("deleted - want: 1, got: %d", n)
+	}
+
+	// not stored while opted out
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 2, ChatID: chatID, UserID: userID, Text: "during"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FindMessage(context.TODO(), chatID, 2)
+	if err != repo.ErrNotFound {
+		t.Fatalf("err - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	// other chats are not affected
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 2, ChatID: 2, UserID: userID, Text: "other chat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FindMessage(context.TODO(), 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	optOuts, err := db.FindMessageOptOuts(context.TODO(), chatID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(optOuts) != 1 || optOuts[0] != userID {
+		t.Fatalf("opt outs - want: [%d], got: %v", userID, optOuts)
+	}
+
+	err = db.SetMessageOptOut(context.TODO(), chatID, userID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 3, ChatID: chatID, UserID: userID, Text: "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FindMessage(context.TODO(), chatID, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindUserData(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	const userID = 10
+
+	err := db.SaveUser(repo.User{ID: userID, Username: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveUserTopic(repo.UserTopic{ChatID: 1, UserID: userID, Topic: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: 1, UserID: userID, Text: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveMessage(context.TODO(), repo.Message{ID: 2, ChatID: 1, UserID: 20, Text: "someone else"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.EditMessage(context.TODO(), 1, 1, "edited", "", time.Unix(100, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.EditMessage(context.TODO(), 1, 2, "someone else edited", "", time.Unix(100, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveVoice(repo.Voice{FileID: "file", UserID: userID, SavedBy: 20, ChatID: 1, Name: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetMessageOptOut(context.TODO(), 2, userID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := db.FindUserData(context.TODO(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.User == nil || data.User.Username != "user" {
+		t.Errorf("user - want: user, got: %+v", data.User)
+	}
+	if len(data.Topics) != 1 {
+		t.Errorf("topics - want: 1, got: %d", len(data.Topics))
+	}
+	if len(data.Messages) != 1 || data.Messages[0].Text != "edited" {
+		t.Errorf("messages - want: [edited], got: %+v", data.Messages)
+	}
+	if len(data.MessageRevisions) != 1 || data.MessageRevisions[0].Text != "text" {
+		t.Errorf("revisions - want: [text], got: %+v", data.MessageRevisions)
+	}
+	if len(data.Voices) != 1 {
+		t.Errorf("voices - want: 1, got: %d", len(data.Voices))
+	}
+	if len(data.MessageOptOuts) != 1 || data.MessageOptOuts[0] != 2 {
+		t.Errorf("opt outs - want: [2], got: %v", data.MessageOptOuts)
+	}
+}
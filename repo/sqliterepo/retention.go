@@ -0,0 +1,188 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+type rawRetentionPolicy struct {
+	ChatID        int64 `db:"chat_id"`
+	MaxAgeSeconds int64 `db:"max_age_seconds"`
+	MaxRows       int   `db:"max_rows"`
+}
+
+func (r rawRetentionPolicy) policy() repo.RetentionPolicy {
+	return repo.RetentionPolicy{
+		ChatID:  r.ChatID,
+		MaxAge:  time.Duration(r.MaxAgeSeconds) * time.Second,
+		MaxRows: r.MaxRows,
+	}
+}
+
+func (db *sqliteRepo) SaveRetentionPolicy(ctx context.Context, p repo.RetentionPolicy) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO retention_policy
+			(chat_id, max_age_seconds, max_rows)
+		VALUES
+			($1, $2, $3)
+		ON CONFLICT DO UPDATE
+		SET
+			max_age_seconds = $2,
+			max_rows = $3
+	`, p.ChatID, int64(p.MaxAge/time.Second), p.MaxRows)
+	return err
+}
+
+// FindRetentionPolicy returns the policy of the chat, or a policy without limits if none was set
+func (db *sqliteRepo) FindRetentionPolicy(ctx context.Context, chatID int64) (*repo.RetentionPolicy, error) {
+	var raw rawRetentionPolicy
+	err := db.read.GetContext(ctx, &raw, `
+		SELECT * FROM retention_policy
+		WHERE chat_id = $1
+	`, chatID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return &repo.RetentionPolicy{ChatID: chatID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := raw.policy()
+	return &p, nil
+}
+
+// PruneMessages deletes the messages that are out of the retention policy of their chats.
+// Rows are deleted in small batches, each in its own transaction, so the database
+// isn't locked for long while handlers are saving messages.
+func (db *sqliteRepo) PruneMessages(ctx context.Context) (int64, error) {
+	raws := []rawRetentionPolicy{}
+	err := db.read.SelectContext(ctx, &raws, `
+		SELECT * FROM retention_policy
+		WHERE max_age_seconds > 0 OR max_rows > 0
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	total := int64(0)
+
+	for _, raw := range raws {
+		p := raw.policy()
+
+		if p.MaxAge > 0 {
+			n, err := db.deleteInBatches(ctx, `
+				DELETE FROM message
+				WHERE rowid IN (
+					SELECT rowid FROM message
+					WHERE chat_id = $1 AND date < $2
+					LIMIT $3
+				)
+			`, p.ChatID, db.now().Add(-p.MaxAge))
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+
+		if p.MaxRows > 0 {
+			n, err := db.deleteInBatches(ctx, `
+				DELETE FROM message
+				WHERE rowid IN (
+					SELECT rowid FROM message
+					WHERE chat_id = $1
+					ORDER BY date DESC, id DESC
+					LIMIT $3 OFFSET $2
+				)
+			`, p.ChatID, p.MaxRows)
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+
+	if total >= db.vacuumThreshold {
+		err = db.vacuum(ctx)
+	}
+
+	return total, err
+}
+
+// deleteInBatches runs query until it deletes less than a batch.
+// query receives the chat id, arg and the batch size.
+func (db *sqliteRepo) deleteInBatches(ctx context.Context, query string, chatID int64, arg any) (int64, error) {
+	total := int64(0)
+
+	for {
+		res, err := db.db.ExecContext(ctx, query, chatID, arg, db.pruneBatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+
+		if n < int64(db.pruneBatchSize) {
+			return total, nil
+		}
+	}
+}
+
+// enableIncrementalVacuum turns auto_vacuum = INCREMENTAL on, so the pruner only
+// has to release the free pages. Changing it on an existing database takes a full
+// VACUUM, which can't run inside a transaction, so it is done once here.
+func (db *sqliteRepo) enableIncrementalVacuum(ctx context.Context) error {
+	var autoVacuum int
+	err := db.db.GetContext(ctx, &autoVacuum, "PRAGMA auto_vacuum")
+	if err != nil {
+		return err
+	}
+
+	// 2 = INCREMENTAL
+	if autoVacuum == 2 {
+		return nil
+	}
+
+	_, err = db.db.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.ExecContext(ctx, "VACUUM")
+	return err
+}
+
+// vacuum releases the pages freed by deleted rows
+func (db *sqliteRepo) vacuum(ctx context.Context) error {
+	_, err := db.db.ExecContext(ctx, "PRAGMA incremental_vacuum")
+	return err
+}
+
+// RunPruner calls PruneMessages every interval until ctx is done
+func RunPruner(ctx context.Context, r repo.Repo, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.PruneMessages(ctx)
+		if err != nil {
+			log.Print("prune messages: ", err)
+		}
+		if n > 0 {
+			log.Printf("pruned %d messages", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
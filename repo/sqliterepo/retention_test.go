@@ -0,0 +1,201 @@
+package sqliterepo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	// chats without policy have no limits
+	p, err := db.FindRetentionPolicy(context.TODO(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p != (repo.RetentionPolicy{ChatID: 1}) {
+		t.Fatalf("want: no limits, got: %+v", *p)
+	}
+
+	want := repo.RetentionPolicy{
+		ChatID:  1,
+		MaxAge:  30 * 24 * time.Hour,
+		MaxRows: 1000,
+	}
+	err = db.SaveRetentionPolicy(context.TODO(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = db.FindRetentionPolicy(context.TODO(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p != want {
+		t.Fatalf("want: %+v, got: %+v", want, *p)
+	}
+}
+
+func TestPruneMessagesByAge(t *testing.T) {
+	_db := newDB(t)
+	defer _db.Close()
+	db := _db.(*sqliteRepo)
+	db.pruneBatchSize = 3
+
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)
+	db.now = func() time.Time { return now }
+
+	// one message per hour, the last one 1h ago
+	for i := 1; i <= 10; i++ {
+		err := db.SaveMessage(context.TODO(), repo.Message{
+			ID:     i,
+			ChatID: 1,
+			Text:   "text",
+			Date:   now.Add(-time.Duration(11-i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// other chat has no policy
+	err := db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: 2, Date: now.Add(-100 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SaveRetentionPolicy(context.TODO(), repo.RetentionPolicy{ChatID: 1, MaxAge: 5*time.Hour + time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.PruneMessages(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Fatalf("pruned - want: 5, got: %d", n)
+	}
+
+	// time passes
+	now = now.Add(2 * time.Hour)
+
+	n, err = db.PruneMessages(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("pruned - want: 2, got: %d", n)
+	}
+
+	msgs, err := db.FindMessagesBeforeDate(context.TODO(), 1, now, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].ID != 8 {
+		t.Fatalf("want: messages 8 to 10, got: %+v", msgs)
+	}
+
+	_, err = db.FindMessage(context.TODO(), 2, 1)
+	if err != nil {
+		t.Fatalf("message from chat without policy must be kept: %v", err)
+	}
+}
+
+func TestPruneMessagesByCount(t *testing.T) {
+	_db := newDB(t)
+	defer _db.Close()
+	db := _db.(*sqliteRepo)
+	db.pruneBatchSize = 2
+
+	date := time.Date(2023, 6, 1, 12, 0, 0, 0, time.Local)
+	for i := 1; i <= 10; i++ {
+		err := db.SaveMessage(context.TODO(), repo.Message{
+			ID:     i,
+			ChatID: 1,
+			Text:   "text",
+			Date:   date.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := db.SaveRetentionPolicy(context.TODO(), repo.RetentionPolicy{ChatID: 1, MaxRows: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.PruneMessages(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Fatalf("pruned - want: 7, got: %d", n)
+	}
+
+	msgs, err := db.FindMessagesBeforeDate(context.TODO(), 1, date.Add(time.Hour), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].ID != 8 {
+		t.Fatalf("want: messages 8 to 10, got: %+v", msgs)
+	}
+}
+
+func TestPruneMessagesVacuum(t *testing.T) {
+	_db := newDB(t)
+	defer _db.Close()
+	db := _db.(*sqliteRepo)
+	db.vacuumThreshold = 10
+
+	err := db.SaveRetentionPolicy(context.TODO(), repo.RetentionPolicy{ChatID: 1, MaxRows: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i <= 10; i++ {
+		err := db.SaveMessage(context.TODO(), repo.Message{ID: i, ChatID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := db.PruneMessages(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("pruned - want: 10, got: %d", n)
+	}
+}
+
+func TestOpenEnablesIncrementalVacuum(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "db.sqlite")
+
+	for i := 0; i < 2; i++ {
+		_db, err := Open(context.TODO(), dsn, "./migrations")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := _db.(*sqliteRepo)
+
+		var autoVacuum int
+		err = db.db.GetContext(context.TODO(), &autoVacuum, "PRAGMA auto_vacuum")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if autoVacuum != 2 {
+			t.Fatalf("auto_vacuum - want: 2, got: %d", autoVacuum)
+		}
+
+		err = db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -4,89 +4,114 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/igoracmelo/euperturbot/repo"
 	"github.com/jmoiron/sqlx"
 )
 
 type sqliteRepo struct {
-	db      *sqlx.DB
+	// db is the only connection that writes, so writers wait for each other
+	// in the pool instead of failing with SQLITE_BUSY
+	db *sqlx.DB
+	// read has the connections for the queries outside transactions. With WAL
+	// they don't block the writer nor each other.
+	read    *sqlx.DB
+	dsn     string
 	Version int
+	now     func() time.Time
+	// how many rows each DELETE of the pruner removes at most
+	pruneBatchSize int
+	// deleting more rows than this in a run makes the pruner reclaim the free space
+	vacuumThreshold int64
 }
 
+// Open opens the database and applies the pending migrations. They are read
+// from dir if it is set, or else the ones embedded in the binary are used.
 func Open(ctx context.Context, dsn string, dir string) (repo.Repo, error) {
-	db, err := sqlx.Open("sqlite", dsn)
+	repo, err := open(dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Ping()
+	err = repo.migrate(ctx, migrationsFS(dir))
 	if err != nil {
-		return nil, err
+		return repo, err
 	}
 
-	repo := &sqliteRepo{
-		db,
-		0,
-	}
-
-	err = repo.migrate(ctx, dir)
+	err = repo.enableIncrementalVacuum(ctx)
 	return repo, err
 }
 
-func (db *sqliteRepo) migrate(ctx context.Context, dir string) error {
-	var version int
+// busyTimeout is how long a connection waits for a lock held by another
+// process, like the backup, before failing with SQLITE_BUSY
+const busyTimeout = 5 * time.Second
+
+// readers is the size of the reader pool
+const readers = 4
 
-	err := db.db.QueryRowContext(ctx, "PRAGMA user_version;").Scan(&version)
+func open(dsn string) (*sqliteRepo, error) {
+	db, err := openPool(dsn,
+		"_txlock=immediate",
+		"_pragma=journal_mode(WAL)",
+		"_pragma=synchronous(NORMAL)",
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	db.Version = version
-
-	fname := filepath.Join(dir, fmt.Sprintf("%d.sql", version+1))
-	_, err = os.Stat(fname)
-	if errors.Is(err, os.ErrNotExist) {
-		// migration does not exist. assume we are on latest
-		return nil
+	db.SetMaxOpenConns(1)
+
+	read := db
+	// every connection to :memory: opens a different database
+	if dsn != ":memory:" {
+		read, err = openPool(dsn, "_pragma=query_only(1)")
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		read.SetMaxOpenConns(readers)
 	}
 
-	log.Printf("RUN %s", fname)
-	query, err := os.ReadFile(fname)
-	if err != nil {
-		return err
-	}
+	return &sqliteRepo{
+		db:              db,
+		read:            read,
+		dsn:             dsn,
+		now:             time.Now,
+		pruneBatchSize:  500,
+		vacuumThreshold: 10000,
+	}, nil
+}
 
-	tx, err := db.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+// openPool opens dsn with the params every connection needs plus the given ones
+func openPool(dsn string, params ...string) (*sqlx.DB, error) {
+	params = append([]string{
+		fmt.Sprintf("_pragma=busy_timeout(%d)", busyTimeout.Milliseconds()),
+		"_pragma=foreign_keys(1)",
+	}, params...)
 
-	_, err = tx.ExecContext(ctx, string(query))
-	if err != nil {
-		return err
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
 	}
 
-	err = tx.Commit()
+	db, err := sqlx.Open("sqlite", dsn+sep+strings.Join(params, "&"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// PRAGMA doesn't support $1, but it is safe to use fmt.Sprintf here
-	_, err = db.db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1))
+	err = db.Ping()
 	if err != nil {
-		return err
+		db.Close()
+		return nil, err
 	}
-
-	db.Version = version + 1
-	log.Printf("SUCCESS")
-
-	return db.migrate(ctx, dir)
+	return db, nil
 }
 
 func (db *sqliteRepo) Close() error {
-	return db.db.Close()
+	var err error
+	if db.read != db.db {
+		err = db.read.Close()
+	}
+	return errors.Join(err, db.db.Close())
 }
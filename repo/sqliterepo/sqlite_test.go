@@ -2,8 +2,14 @@ package sqliterepo
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 )
 
@@ -15,7 +21,172 @@ func Test_Migrate(t *testing.T) {
 	db := _db.(*sqliteRepo)
 
 	// this test has to be updated anytime a new migration is created, on purpose
-	if db.Version != 11 {
-		t.Fatalf("version - want: %d, got: %d", 11, db.Version)
+	if db.Version != 23 {
+		t.Fatalf("version - want: %d, got: %d", 23, db.Version)
 	}
 }
+
+func openFile(tb testing.TB) *sqliteRepo {
+	tb.Helper()
+
+	db, err := Open(context.TODO(), filepath.Join(tb.TempDir(), "bot.db"), "./migrations")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		db.Close()
+	})
+	return db.(*sqliteRepo)
+}
+
+func TestOpenSettings(t *testing.T) {
+	db := openFile(t)
+
+	var journal string
+	err := db.db.Get(&journal, "PRAGMA journal_mode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal != "wal" {
+		t.Fatalf("journal mode - want: %s, got: %s", "wal", journal)
+	}
+
+	for name, pool := range map[string]*sqlx.DB{"writer": db.db, "reader": db.read} {
+		var timeout, foreignKeys int
+		err = pool.Get(&timeout, "PRAGMA busy_timeout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timeout != int(busyTimeout.Milliseconds()) {
+			t.Fatalf("%s busy timeout - want: %d, got: %d", name, busyTimeout.Milliseconds(), timeout)
+		}
+		err = pool.Get(&foreignKeys, "PRAGMA foreign_keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if foreignKeys != 1 {
+			t.Fatalf("%s foreign keys - want: %d, got: %d", name, 1, foreignKeys)
+		}
+	}
+
+	_, err = db.read.Exec("DELETE FROM message")
+	if err == nil {
+		t.Fatal("the reader pool should not write")
+	}
+
+	err = db.SavePollVote(repo.PollVote{PollID: "nope", UserID: 1, Vote: repo.VoteUp})
+	if err == nil {
+		t.Fatal("want foreign key error, got nil")
+	}
+}
+
+// the handlers use the repo concurrently, and none of them should fail with SQLITE_BUSY
+func TestConcurrentAccess(t *testing.T) {
+	db := openFile(t)
+
+	const workers = 10
+	const count = 50
+
+	for chat := int64(1); chat <= workers; chat++ {
+		err := db.SavePoll(repo.Poll{ID: fmt.Sprint(chat), ChatID: chat, Topic: "topic", ResultMessageID: int(chat)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	errs := make(chan error, workers*count*4)
+	wg := sync.WaitGroup{}
+
+	for w := 1; w <= workers; w++ {
+		wg.Add(1)
+		go func(chatID int64) {
+			defer wg.Done()
+			for i := 1; i <= count; i++ {
+				errs <- db.SaveMessage(context.TODO(), repo.Message{
+					ID:       i,
+					ChatID:   chatID,
+					Text:     "text",
+					Date:     start.Add(time.Duration(i) * time.Second),
+					UserID:   int64(i),
+					UserName: "name",
+				})
+				errs <- db.SavePollVote(repo.PollVote{PollID: fmt.Sprint(chatID), UserID: int64(i), Vote: repo.VoteUp})
+				errs <- db.EditMessage(context.TODO(), chatID, i, "edited", "", start)
+
+				_, err := db.FindMessagesBeforeDate(context.TODO(), chatID, start.Add(time.Hour), 10)
+				errs <- err
+			}
+		}(int64(w))
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var messages, votes int
+	err := db.db.Get(&messages, "SELECT COUNT(*) FROM message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages != workers*count {
+		t.Fatalf("messages - want: %d, got: %d", workers*count, messages)
+	}
+	err = db.db.Get(&votes, "SELECT COUNT(*) FROM poll_vote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if votes != workers*count {
+		t.Fatalf("votes - want: %d, got: %d", workers*count, votes)
+	}
+}
+
+func BenchmarkSaveMessage(b *testing.B) {
+	db := openFile(b)
+
+	var id int64
+	mut := sync.Mutex{}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mut.Lock()
+			id++
+			msgID := int(id)
+			mut.Unlock()
+
+			err := db.SaveMessage(context.TODO(), repo.Message{ID: msgID, ChatID: 1, Text: "text", Date: time.Now()})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkFindMessagesBeforeDate(b *testing.B) {
+	db := openFile(b)
+
+	start := time.Now()
+	for chat := int64(1); chat <= 10; chat++ {
+		for i := 1; i <= 1000; i++ {
+			err := db.SaveMessage(context.TODO(), repo.Message{ID: i, ChatID: chat, Text: "text", Date: start.Add(time.Duration(i) * time.Second)})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := db.FindMessagesBeforeDate(context.TODO(), 5, start.Add(500*time.Second), 20)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
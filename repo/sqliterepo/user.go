@@ -20,12 +20,12 @@ func (db *sqliteRepo) SaveUser(u repo.User) error {
 
 func (db *sqliteRepo) FindUser(id int64) (*repo.User, error) {
 	var u repo.User
-	err := db.db.GetContext(context.TODO(), &u, `SELECT * FROM user WHERE id = $1`, id)
+	err := db.read.GetContext(context.TODO(), &u, `SELECT * FROM user WHERE id = $1`, id)
 	return &u, err
 }
 
 func (db *sqliteRepo) ExistsChatTopic(chatID int64, topic string) (bool, error) {
-	row := db.db.QueryRowContext(context.TODO(), `
+	row := db.read.QueryRowContext(context.TODO(), `
 		SELECT EXISTS (
 			SELECT * FROM user_topic
 			WHERE chat_id = $1 AND topic = $2
@@ -72,7 +72,7 @@ func (db *sqliteRepo) FindUserChatTopics(chatID, userID int64) ([]repo.UserTopic
 		WHERE chat_id = $1 AND user_id = $2
 	`
 	var topics []repo.UserTopic
-	err := db.db.SelectContext(context.TODO(), &topics, sql, chatID, userID)
+	err := db.read.SelectContext(context.TODO(), &topics, sql, chatID, userID)
 	return topics, err
 }
 
@@ -84,7 +84,7 @@ func (db *sqliteRepo) FindChatTopics(chatID int64) ([]repo.UserTopic, error) {
 		ORDER BY subscribers DESC
 	`
 	var topics []repo.UserTopic
-	err := db.db.SelectContext(context.TODO(), &topics, sql, chatID)
+	err := db.read.SelectContext(context.TODO(), &topics, sql, chatID)
 	return topics, err
 }
 
@@ -95,6 +95,6 @@ func (db *sqliteRepo) FindUsersByTopic(chatID int64, topic string) ([]repo.User,
 		WHERE ut.chat_id = $1 AND ut.topic = $2
 	`
 	var users []repo.User
-	err := db.db.SelectContext(context.TODO(), &users, sql, chatID, topic)
+	err := db.read.SelectContext(context.TODO(), &users, sql, chatID, topic)
 	return users, err
 }
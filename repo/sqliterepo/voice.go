@@ -2,31 +2,283 @@ package sqliterepo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"strings"
 
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
+// selectVoice selects the voice columns with the tags separated by spaces
+const selectVoice = `
+	SELECT
+		voice.*,
+		COALESCE((
+			SELECT group_concat(tag, ' ') FROM (
+				SELECT tag FROM voice_tag
+				WHERE voice_id = voice.id
+				ORDER BY tag
+			)
+		), '') AS tags
+	FROM voice
+`
+
+type rawVoice struct {
+	ID          int64
+	ChatID      int64  `db:"chat_id"`
+	FileID      string `db:"file_id"`
+	UserID      int64  `db:"user_id"`
+	SavedBy     int64  `db:"saved_by"`
+	SavedByName string `db:"saved_by_name"`
+	Name        string
+	Label       string
+	Tags        string
+}
+
+func (r rawVoice) voice() repo.Voice {
+	return repo.Voice{
+		ID:          r.ID,
+		ChatID:      r.ChatID,
+		FileID:      r.FileID,
+		UserID:      r.UserID,
+		SavedBy:     r.SavedBy,
+		SavedByName: r.SavedByName,
+		Name:        r.Name,
+		Label:       r.Label,
+		Tags:        strings.Fields(r.Tags),
+	}
+}
+
+// SaveVoice saves the voice with its tags. It fails with repo.ErrVoiceNameTaken
+// or repo.ErrVoiceAlreadySaved if the chat already has the name or the audio.
 func (db *sqliteRepo) SaveVoice(v repo.Voice) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+	ctx := context.TODO()
+
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing rawVoice
+	err = tx.GetContext(ctx, &existing, selectVoice+`
+		WHERE chat_id = $1 AND (name = $2 OR file_id = $3)
+		LIMIT 1
+	`, v.ChatID, v.Name, v.FileID)
+	if err == nil {
+		if existing.Name == v.Name {
+			return repo.ErrVoiceNameTaken
+		}
+		return repo.ErrVoiceAlreadySaved
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
 		INSERT INTO voice
-			(file_id, user_id, chat_id)
+			(chat_id, file_id, user_id, saved_by, saved_by_name, name, label)
 		VALUES
-			($1, $2, $3)
-		ON CONFLICT DO UPDATE
-		SET
-			user_id = $2,
-			chat_id = $3
-	`, v.FileID, v.UserID, v.ChatID)
-	return err
+			($1, $2, $3, $4, $5, $6, $7)
+	`, v.ChatID, v.FileID, v.UserID, v.SavedBy, v.SavedByName, v.Name, v.Label)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range v.Tags {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO voice_tag
+				(voice_id, tag)
+			VALUES
+				($1, $2)
+			ON CONFLICT DO NOTHING
+		`, id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (db *sqliteRepo) FindRandomVoice(chatID int64) (*repo.Voice, error) {
-	var v repo.Voice
-	err := db.db.GetContext(context.TODO(), &v, `
-		SELECT * FROM voice
-		WHERE chat_id = $1
+// FindRandomVoice picks a random voice of the chat. If tag is not empty, only
+// voices with that tag are considered.
+func (db *sqliteRepo) FindRandomVoice(chatID int64, tag string) (*repo.Voice, error) {
+	var raw rawVoice
+	err := db.read.GetContext(context.TODO(), &raw, selectVoice+`
+		WHERE
+			chat_id = $1 AND
+			($2 = '' OR EXISTS (
+				SELECT 1 FROM voice_tag
+				WHERE voice_id = voice.id AND tag = $2
+			))
 		ORDER BY RANDOM()
 		LIMIT 1
-	`, chatID)
-	return &v, err
+	`, chatID, tag)
+	if err != nil {
+		return nil, err
+	}
+	v := raw.voice()
+	return &v, nil
+}
+
+func (db *sqliteRepo) FindVoice(ctx context.Context, chatID int64, name string) (*repo.Voice, error) {
+	var raw rawVoice
+	err := db.read.GetContext(ctx, &raw, selectVoice+`
+		WHERE chat_id = $1 AND name = $2
+	`, chatID, name)
+	if err != nil {
+		return nil, err
+	}
+	v := raw.voice()
+	return &v, nil
+}
+
+// FindVoices lists the voices of the chat by name
+func (db *sqliteRepo) FindVoices(ctx context.Context, chatID int64, limit int, offset int) ([]repo.Voice, error) {
+	raws := []rawVoice{}
+	err := db.read.SelectContext(ctx, &raws, selectVoice+`
+		WHERE chat_id = $1
+		ORDER BY name
+		LIMIT $2 OFFSET $3
+	`, chatID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	voices := make([]repo.Voice, 0, len(raws))
+	for _, raw := range raws {
+		voices = append(voices, raw.voice())
+	}
+	return voices, nil
+}
+
+func (db *sqliteRepo) RenameVoice(ctx context.Context, chatID int64, name string, newName string) error {
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.GetContext(ctx, &taken, `
+		SELECT EXISTS (
+			SELECT 1 FROM voice
+			WHERE chat_id = $1 AND name = $2
+		)
+	`, chatID, newName)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return repo.ErrVoiceNameTaken
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE voice
+		SET name = $3
+		WHERE chat_id = $1 AND name = $2
+	`, chatID, name, newName)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repo.ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (db *sqliteRepo) DeleteVoice(ctx context.Context, chatID int64, name string) error {
+	res, err := db.db.ExecContext(ctx, `
+		DELETE FROM voice
+		WHERE chat_id = $1 AND name = $2
+	`, chatID, name)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repo.ErrNotFound
+	}
+	return nil
+}
+
+// SearchVoices finds the voices of the chat where every term of the query
+// appears in the name, a tag, the label or the name of who saved it
+func (db *sqliteRepo) SearchVoices(ctx context.Context, chatID int64, query string, limit int, offset int) ([]repo.Voice, error) {
+	where := "chat_id = ?"
+	args := []any{chatID}
+
+	for _, term := range strings.Fields(query) {
+		where += ` AND (
+			name LIKE ? ESCAPE '\' OR
+			label LIKE ? ESCAPE '\' OR
+			saved_by_name LIKE ? ESCAPE '\' OR
+			EXISTS (
+				SELECT 1 FROM voice_tag
+				WHERE voice_id = voice.id AND tag LIKE ? ESCAPE '\'
+			)
+		)`
+		pattern := "%" + escapeLike(term) + "%"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	args = append(args, limit, offset)
+
+	raws := []rawVoice{}
+	err := db.read.SelectContext(ctx, &raws, selectVoice+`
+		WHERE `+where+`
+		ORDER BY name
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	voices := make([]repo.Voice, 0, len(raws))
+	for _, raw := range raws {
+		voices = append(voices, raw.voice())
+	}
+	return voices, nil
+}
+
+func (db *sqliteRepo) SaveInlineChat(ctx context.Context, userID int64, chatID int64) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO inline_chat
+			(user_id, chat_id)
+		VALUES
+			($1, $2)
+		ON CONFLICT DO UPDATE
+		SET chat_id = $2
+	`, userID, chatID)
+	return err
+}
+
+// FindInlineChat returns the chat whose voices the user searches in inline mode
+func (db *sqliteRepo) FindInlineChat(ctx context.Context, userID int64) (int64, error) {
+	var chatID int64
+	err := db.read.GetContext(ctx, &chatID, `
+		SELECT chat_id FROM inline_chat
+		WHERE user_id = $1
+	`, userID)
+	return chatID, err
+}
+
+// escapeLike escapes the LIKE wildcards, so the text is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
@@ -0,0 +1,256 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestSaveVoice(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	err := db.SaveVoice(repo.Voice{ChatID: 1, FileID: "file1", UserID: 1, SavedBy: 2, Name: "grito", Tags: []string{"zoeira", "bom"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SaveVoice(repo.Voice{ChatID: 1, FileID: "file2", Name: "grito"})
+	if !errors.Is(err, repo.ErrVoiceNameTaken) {
+		t.Fatalf("same name - want: %v, got: %v", repo.ErrVoiceNameTaken, err)
+	}
+
+	err = db.SaveVoice(repo.Voice{ChatID: 1, FileID: "file1", Name: "outro"})
+	if !errors.Is(err, repo.ErrVoiceAlreadySaved) {
+		t.Fatalf("same file - want: %v, got: %v", repo.ErrVoiceAlreadySaved, err)
+	}
+
+	// names and files are unique per chat
+	err = db.SaveVoice(repo.Voice{ChatID: 2, FileID: "file1", Name: "grito"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.FindVoice(context.TODO(), 1, "grito")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repo.Voice{ID: v.ID, ChatID: 1, FileID: "file1", UserID: 1, SavedBy: 2, Name: "grito", Tags: []string{"bom", "zoeira"}}
+	if !reflect.DeepEqual(*v, want) {
+		t.Fatalf("voice - want: %+v, got: %+v", want, *v)
+	}
+}
+
+func TestFindRandomVoice(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	voices := []repo.Voice{
+		{ChatID: 1, FileID: "file1", Name: "a", Tags: []string{"zoeira"}},
+		{ChatID: 1, FileID: "file2", Name: "b"},
+		{ChatID: 2, FileID: "file3", Name: "c", Tags: []string{"zoeira"}},
+	}
+	for _, v := range voices {
+		err := db.SaveVoice(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		v, err := db.FindRandomVoice(1, "zoeira")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Name != "a" {
+			t.Fatalf("tagged voice - want: a, got: %s", v.Name)
+		}
+	}
+
+	_, err := db.FindRandomVoice(1, "nada")
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("unknown tag - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	v, err := db.FindRandomVoice(2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "c" {
+		t.Fatalf("any voice - want: c, got: %s", v.Name)
+	}
+}
+
+func TestFindVoices(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	for _, name := range []string{"c", "a", "b"} {
+		err := db.SaveVoice(repo.Voice{ChatID: 1, FileID: name, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	voices, err := db.FindVoices(context.TODO(), 1, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, v := range voices {
+		names = append(names, v.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Fatalf("names - want: [b c], got: %v", names)
+	}
+}
+
+func TestRenameAndDeleteVoice(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	for _, name := range []string{"a", "b"} {
+		err := db.SaveVoice(repo.Voice{ChatID: 1, FileID: name, Name: name, Tags: []string{"tag"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := db.RenameVoice(context.TODO(), 1, "a", "b")
+	if !errors.Is(err, repo.ErrVoiceNameTaken) {
+		t.Fatalf("rename to taken - want: %v, got: %v", repo.ErrVoiceNameTaken, err)
+	}
+
+	err = db.RenameVoice(context.TODO(), 1, "x", "y")
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("rename missing - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	err = db.RenameVoice(context.TODO(), 1, "a", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FindVoice(context.TODO(), 1, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DeleteVoice(context.TODO(), 1, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.DeleteVoice(context.TODO(), 1, "c")
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("delete missing - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	var tags int
+	err = db.(*sqliteRepo).db.Get(&tags, "SELECT COUNT(*) FROM voice_tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags != 1 {
+		t.Fatalf("tags left - want: 1, got: %d", tags)
+	}
+}
+
+func TestSearchVoices(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	voices := []repo.Voice{
+		{ChatID: 1, FileID: "1", Name: "grito", Tags: []string{"zoeira"}, SavedByName: "Maria"},
+		{ChatID: 1, FileID: "2", Name: "bom_dia", Label: "bom dia grupo", SavedByName: "João"},
+		{ChatID: 1, FileID: "3", Name: "risada", Tags: []string{"zoeira", "risos"}, SavedByName: "João"},
+		{ChatID: 2, FileID: "4", Name: "grito", SavedByName: "Maria"},
+	}
+	for _, v := range voices {
+		err := db.SaveVoice(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"bom_dia", "grito", "risada"}},
+		{query: "zoe", want: []string{"grito", "risada"}},
+		{query: "zoeira joão", want: []string{"risada"}},
+		{query: "GRUPO", want: []string{"bom_dia"}},
+		// _ is not a wildcard
+		{query: "b_m", want: []string{}},
+		{query: "nada", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := db.SearchVoices(context.TODO(), 1, tt.query, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, v := range got {
+			names = append(names, v.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%q - want: %v, got: %v", tt.query, tt.want, names)
+		}
+	}
+}
+
+func TestInlineChat(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	_, err := db.FindInlineChat(context.TODO(), 1)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("not set - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	for _, chatID := range []int64{10, 20} {
+		err = db.SaveInlineChat(context.TODO(), 1, chatID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chatID, err := db.FindInlineChat(context.TODO(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatID != 20 {
+		t.Fatalf("chat - want: 20, got: %d", chatID)
+	}
+}
+
+func TestTranscriptionLabelsVoice(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	err := db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: 1, ContentType: repo.ContentTypeVoice, FileID: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveVoice(repo.Voice{ChatID: 1, FileID: "file", Name: "audio"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SaveTranscription(context.TODO(), 1, 1, "bom dia")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := db.FindVoice(context.TODO(), 1, "audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Label != "bom dia" {
+		t.Fatalf("label - want: bom dia, got: %s", v.Label)
+	}
+}
@@ -0,0 +1,528 @@
+// Package sed runs the subset of sed scripts people type in chats, without
+// calling the sed binary:
+//
+//	s/regexp/replacement/flags
+//	y/source/dest/
+//
+// Commands are chained with ; and applied to each line, like sed -E does.
+// The regexps use the syntax of the regexp package, which is close to
+// POSIX extended regexps.
+package sed
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Limits protect the bot from scripts that are too expensive
+type Limits struct {
+	// MaxScriptSize is the size of the script in bytes
+	MaxScriptSize int
+	// MaxPatternSize is the size of each regexp in bytes
+	MaxPatternSize int
+	// MaxOutputSize is the size in bytes of the result, and of every
+	// intermediate result
+	MaxOutputSize int
+	// Timeout is checked between the commands and between the matches
+	Timeout time.Duration
+}
+
+// DefaultLimits fit in a telegram message
+var DefaultLimits = Limits{
+	MaxScriptSize:  1024,
+	MaxPatternSize: 256,
+	MaxOutputSize:  4096,
+	Timeout:        time.Second,
+}
+
+// Error is a problem with the script or its result. The message is in
+// portuguese, since it is meant to be shown in the chat.
+type Error struct {
+	msg string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func errorf(format string, args ...any) *Error {
+	return &Error{msg: fmt.Sprintf(format, args...)}
+}
+
+var (
+	ErrTimeout        = &Error{msg: "demorou demais"}
+	ErrOutputTooLarge = &Error{msg: "o resultado ficou grande demais"}
+)
+
+// Run applies the script to each line of input
+func Run(ctx context.Context, script string, input string, limits Limits) (string, error) {
+	cmds, err := Parse(script, limits)
+	if err != nil {
+		return "", err
+	}
+	return cmds.Run(ctx, input, limits)
+}
+
+// Script is a parsed script
+type Script []command
+
+type command interface {
+	apply(r *runner, line string) (string, error)
+}
+
+// Run applies the script to each line of input
+func (s Script) Run(ctx context.Context, input string, limits Limits) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	r := &runner{ctx: ctx, limits: limits}
+
+	// like sed, a final newline ends the last line instead of starting another
+	if input == "" {
+		return "", nil
+	}
+	end := ""
+	if strings.HasSuffix(input, "\n") {
+		input, end = input[:len(input)-1], "\n"
+	}
+
+	lines := strings.Split(input, "\n")
+	size := 0
+	for i, line := range lines {
+		for _, cmd := range s {
+			err := r.check(len(line))
+			if err != nil {
+				return "", err
+			}
+			line, err = cmd.apply(r, line)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		lines[i] = line
+		size += len(line) + 1
+		if size-1+len(end) > limits.MaxOutputSize {
+			return "", ErrOutputTooLarge
+		}
+	}
+
+	return strings.Join(lines, "\n") + end, nil
+}
+
+type runner struct {
+	ctx    context.Context
+	limits Limits
+}
+
+// check fails if the time is over or the result is too big
+func (r *runner) check(size int) error {
+	if r.ctx.Err() != nil {
+		return ErrTimeout
+	}
+	if size > r.limits.MaxOutputSize {
+		return ErrOutputTooLarge
+	}
+	return nil
+}
+
+type substitute struct {
+	re   *regexp.Regexp
+	repl []replacementPart
+	// global replaces every match after occurrence
+	global bool
+	// occurrence is the first match replaced, starting at 1
+	occurrence int
+}
+
+// replacementPart is either a literal text or a group of the match
+type replacementPart struct {
+	literal string
+	// group is the group of the match, 0 being the whole match, or -1 for
+	// the literal
+	group int
+}
+
+func (s *substitute) apply(r *runner, line string) (string, error) {
+	matches := s.re.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return line, nil
+	}
+
+	b := &strings.Builder{}
+	last := 0
+	for i, m := range matches {
+		n := i + 1
+		if n < s.occurrence || (n > s.occurrence && !s.global) {
+			continue
+		}
+
+		err := r.check(b.Len())
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(line[last:m[0]])
+		for _, part := range s.repl {
+			if part.group < 0 {
+				b.WriteString(part.literal)
+				continue
+			}
+			// groups that didn't participate in the match are empty
+			if start := m[2*part.group]; start >= 0 {
+				b.WriteString(line[start:m[2*part.group+1]])
+			}
+		}
+		last = m[1]
+	}
+	b.WriteString(line[last:])
+
+	return b.String(), r.check(b.Len())
+}
+
+type transliterate map[rune]rune
+
+func (t transliterate) apply(r *runner, line string) (string, error) {
+	return strings.Map(func(c rune) rune {
+		if to, ok := t[c]; ok {
+			return to
+		}
+		return c
+	}, line), nil
+}
+
+// Parse parses the script, checking the limits of its size
+func Parse(script string, limits Limits) (Script, error) {
+	if len(script) > limits.MaxScriptSize {
+		return nil, errorf("o comando é grande demais, o máximo são %d caracteres", limits.MaxScriptSize)
+	}
+
+	p := &parser{s: []rune(script), limits: limits}
+	cmds := Script{}
+	for {
+		p.skip(" \t\n;")
+		if p.done() {
+			break
+		}
+
+		var cmd command
+		var err error
+		switch c := p.next(); c {
+		case 's':
+			cmd, err = p.substitute()
+		case 'y':
+			cmd, err = p.transliterate()
+		default:
+			err = errorf("comando desconhecido %q. use s/a/b/ ou y/abc/xyz/", c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+
+		p.skip(" \t")
+		if !p.done() && p.peek() != ';' && p.peek() != '\n' {
+			return nil, errorf("esperava ; depois do comando %d, achei %q", len(cmds), p.peek())
+		}
+	}
+
+	if len(cmds) == 0 {
+		return nil, errorf("nenhum comando")
+	}
+	return cmds, nil
+}
+
+type parser struct {
+	s      []rune
+	pos    int
+	limits Limits
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() rune {
+	return p.s[p.pos]
+}
+
+func (p *parser) next() rune {
+	c := p.s[p.pos]
+	p.pos++
+	return c
+}
+
+func (p *parser) skip(chars string) {
+	for !p.done() && strings.ContainsRune(chars, p.peek()) {
+		p.pos++
+	}
+}
+
+// delimiter reads the delimiter that follows the command name
+func (p *parser) delimiter(cmd string) (rune, error) {
+	if p.done() {
+		return 0, errorf("faltou o resto do %s. exemplo: %s", cmd, example(cmd))
+	}
+	delim := p.next()
+	if !isDelimiter(delim) {
+		return 0, errorf("%q não pode separar as partes do %s", delim, cmd)
+	}
+	return delim, nil
+}
+
+// isDelimiter tells if c can separate the parts of a command. Unlike GNU sed,
+// letters and digits can't, so ordinary messages aren't taken for commands.
+func isDelimiter(c rune) bool {
+	return c != '\\' && !unicode.IsSpace(c) && !unicode.IsLetter(c) && !unicode.IsDigit(c)
+}
+
+// IsScript tells if the text looks like a sed script: s or y, a delimiter
+// and more text with the delimiter. It doesn't check the rest of the script.
+func IsScript(text string) bool {
+	rs := []rune(text)
+	if len(rs) < 3 || (rs[0] != 's' && rs[0] != 'y') || !isDelimiter(rs[1]) {
+		return false
+	}
+	return strings.ContainsRune(string(rs[2:]), rs[1])
+}
+
+// part reads until the unescaped delim and returns the text with the
+// escapes, except \delim, which becomes delim. Like in GNU sed, s|a\|b|x|
+// has the regexp a|b. The other escapes found in escapes are replaced by
+// their value.
+func (p *parser) part(cmd string, delim rune, escapes map[rune]string) (string, error) {
+	b := &strings.Builder{}
+	for !p.done() {
+		c := p.next()
+		if c == delim {
+			return b.String(), nil
+		}
+		if c != '\\' {
+			b.WriteRune(c)
+			continue
+		}
+
+		if p.done() {
+			break
+		}
+		c = p.next()
+		if c == delim {
+			b.WriteRune(c)
+			continue
+		}
+		if esc, ok := escapes[c]; ok {
+			b.WriteString(esc)
+			continue
+		}
+		b.WriteRune('\\')
+		b.WriteRune(c)
+	}
+
+	return "", errorf("faltou fechar o %s com %c. exemplo: %s", cmd, delim, example(cmd))
+}
+
+// wordBoundaries are the GNU escapes for the start and the end of a word
+var wordBoundaries = map[rune]string{
+	'<': `\b`,
+	'>': `\b`,
+}
+
+func example(cmd string) string {
+	if cmd == "y" {
+		return "y/abc/xyz/"
+	}
+	return "s/antes/depois/g"
+}
+
+func (p *parser) substitute() (command, error) {
+	delim, err := p.delimiter("s")
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, err := p.part("s", delim, wordBoundaries)
+	if err != nil {
+		return nil, err
+	}
+	repl, err := p.part("s", delim, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &substitute{occurrence: 1}
+	ignoreCase := false
+	number := ""
+	for !p.done() && !strings.ContainsRune(" \t\n;", p.peek()) {
+		switch c := p.next(); {
+		case c == 'g':
+			s.global = true
+		case c == 'i' || c == 'I':
+			ignoreCase = true
+		case isDigit(c):
+			// the occurrence is a single number, so 1g2 is wrong
+			if number != "" && !isDigit(p.s[p.pos-2]) {
+				return nil, errorf("só pode ter um número de ocorrência")
+			}
+			number += string(c)
+		default:
+			return nil, errorf("flag %q não suportada. use g, i ou um número", c)
+		}
+	}
+	if number != "" {
+		_, err := fmt.Sscan(number, &s.occurrence)
+		if err != nil || s.occurrence < 1 || s.occurrence > 512 {
+			return nil, errorf("a ocorrência %s não existe. use de 1 a 512", number)
+		}
+	}
+
+	if pattern == "" {
+		return nil, errorf("a expressão do s está vazia")
+	}
+	if len(pattern) > p.limits.MaxPatternSize {
+		return nil, errorf("a expressão é grande demais, o máximo são %d caracteres", p.limits.MaxPatternSize)
+	}
+
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	s.re, err = regexp.Compile(pattern)
+	if err != nil {
+		return nil, regexpError(err)
+	}
+
+	s.repl, err = parseReplacement(repl, s.re.NumSubexp())
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func regexpError(err error) error {
+	synErr, ok := err.(*syntax.Error)
+	if !ok {
+		return errorf("expressão inválida")
+	}
+
+	switch synErr.Code {
+	case syntax.ErrInvalidEscape:
+		return errorf("expressão inválida: %s não é suportado", synErr.Expr)
+	case syntax.ErrMissingParen, syntax.ErrUnexpectedParen:
+		return errorf("expressão inválida: os parênteses não fecham")
+	case syntax.ErrMissingBracket:
+		return errorf("expressão inválida: faltou fechar o [")
+	case syntax.ErrMissingRepeatArgument:
+		return errorf("expressão inválida: %s não repete nada", synErr.Expr)
+	case syntax.ErrInvalidRepeatSize, syntax.ErrLarge:
+		return errorf("expressão inválida: repetição grande demais")
+	}
+	return errorf("expressão inválida: %s", synErr.Expr)
+}
+
+// parseReplacement parses & as the whole match, \1 to \9 as the groups,
+// and the escapes \n, \t, \& and \\
+func parseReplacement(repl string, groups int) ([]replacementPart, error) {
+	parts := []replacementPart{}
+	literal := &strings.Builder{}
+	flush := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, replacementPart{literal: literal.String(), group: -1})
+			literal.Reset()
+		}
+	}
+
+	rs := []rune(repl)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		if c == '&' {
+			flush()
+			parts = append(parts, replacementPart{group: 0})
+			continue
+		}
+		if c != '\\' || i == len(rs)-1 {
+			literal.WriteRune(c)
+			continue
+		}
+
+		i++
+		switch c = rs[i]; {
+		case c >= '0' && c <= '9':
+			group := int(c - '0')
+			if group > groups {
+				return nil, errorf("\\%d não existe, a expressão tem %d grupos", group, groups)
+			}
+			flush()
+			parts = append(parts, replacementPart{group: group})
+		case c == 'n':
+			literal.WriteRune('\n')
+		case c == 't':
+			literal.WriteRune('\t')
+		default:
+			literal.WriteRune(c)
+		}
+	}
+	flush()
+
+	return parts, nil
+}
+
+func (p *parser) transliterate() (command, error) {
+	delim, err := p.delimiter("y")
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := p.part("y", delim, nil)
+	if err != nil {
+		return nil, err
+	}
+	to, err := p.part("y", delim, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fromRunes, toRunes := unescape(from), unescape(to)
+	if len(fromRunes) != len(toRunes) {
+		return nil, errorf("o y precisa de dois textos do mesmo tamanho, mas tem %d e %d caracteres", len(fromRunes), len(toRunes))
+	}
+
+	t := transliterate{}
+	for i, c := range fromRunes {
+		if _, ok := t[c]; ok {
+			return nil, errorf("%q aparece duas vezes no y", c)
+		}
+		t[c] = toRunes[i]
+	}
+	return t, nil
+}
+
+// unescape handles \n, \t and \\ in the texts of y
+func unescape(s string) []rune {
+	rs := []rune(s)
+	out := []rune{}
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '\\' || i == len(rs)-1 {
+			out = append(out, rs[i])
+			continue
+		}
+		i++
+		switch rs[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		default:
+			out = append(out, rs[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,232 @@
+package sed
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		input  string
+		want   string
+	}{
+		// s
+		{"first match", "s/a/b/", "banana", "bbnana"},
+		{"global", "s/a/b/g", "banana", "bbnbnb"},
+		{"no match", "s/x/y/", "banana", "banana"},
+		{"ignore case", "s/BANANA/maçã/i", "Banana split", "maçã split"},
+		{"ignore case upper flag", "s/b/c/Ig", "Bob", "coc"},
+		{"occurrence", "s/a/o/2", "banana", "banona"},
+		{"occurrence and global", "s/a/o/2g", "banana", "banono"},
+		{"occurrence after the last", "s/a/o/4", "banana", "banana"},
+		{"whole match", "s/[0-9]+/<&>/g", "1 e 22", "<1> e <22>"},
+		{"escaped ampersand", `s/e/\&/`, "eu e tu", "&u e tu"},
+		{"groups", `s/(\w+) (\w+)/\2 \1/`, "bom dia", "dia bom"},
+		{"group that didn't match", `s/(a)|(b)/[\1\2]/g`, "ab", "[a][b]"},
+		{"group zero", `s/ban/\0\0/`, "banana", "banbanana"},
+		{"newline in replacement", `s/, /\n/g`, "a, b, c", "a\nb\nc"},
+		{"tab in replacement", `s/ /\t/`, "a b", "a\tb"},
+		{"escaped backslash", `s/a/\\/`, "a", `\`},
+		{"escaped delimiter", `s/\/\//#/`, "// comentário", "# comentário"},
+		{"other delimiter", "s|/usr|/opt|", "/usr/bin", "/opt/bin"},
+		{"escaped delimiter keeps its meaning in the regexp", `s|a\|b|x|`, "a|b ab", "x|b ab"},
+		{"unicode delimiter", "s→a→b→g", "aaa", "bbb"},
+		{"empty replacement", "s/não //", "não gosto", "gosto"},
+		{"empty matches", "s/x*/-/g", "abc", "-a-b-c-"},
+		{"empty matches around a match", "s/b*/x/g", "abc", "xaxcx"},
+		{"anchors apply to each line", "s/^/> /", "a\nb", "> a\n> b"},
+		{"end anchor", "s/$/!/", "oi\ntchau", "oi!\ntchau!"},
+		{"each line has its first match", "s/a/o/", "aa\naa", "oa\noa"},
+		{"word boundaries", `s/\<e\>/E/g`, "e ele e", "E ele E"},
+		{"escaped backslash before <", `s/\\</X/`, `a\<b`, "aXb"},
+		{"< as delimiter", `s<a\<b<x<`, "a<b", "x"},
+		{"posix class", "s/[[:digit:]]/#/g", "a1b2", "a#b#"},
+		{"unicode", "s/ç/c/g", "açúcar e maçã", "acúcar e macã"},
+		{"trailing newline kept", "s/a/b/", "a\n", "b\n"},
+		{"trailing newline is not a line", "s/^/> /", "a\nb\n", "> a\n> b\n"},
+		{"empty line", "s/^/x/", "a\n\nb", "xa\nx\nxb"},
+		{"empty input has no lines", "s/^/x/", "", ""},
+		{"flags then spaces", "s/a/b/g   ", "aa", "bb"},
+
+		// y
+		{"transliterate", "y/abc/xyz/", "aabbcc", "xxyyzz"},
+		{"transliterate unicode", "y/áéí/aei/", "pé í á", "pe i a"},
+		{"transliterate escapes", `y/\/\n/|-/`, "a/b", "a|b"},
+		{"transliterate other delimiter", "y,ab,ba,", "abba", "baab"},
+
+		// chains
+		{"chain", "s/a/b/;s/b/c/", "a", "c"},
+		{"chain with spaces", "s/a/b/g ; y/b/c/", "aba", "ccc"},
+		{"chain with newlines", "s/a/b/\ns/c/d/", "ac", "bd"},
+		{"trailing semicolon", "s/a/b/;", "a", "b"},
+		{"semicolon inside the command", "s/;/,/g", "a;b;c", "a,b,c"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Run(context.TODO(), test.script, test.input, DefaultLimits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("want: %q, got: %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestIsScript(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"s/a/b/", true},
+		{"y/ab/ba/", true},
+		{"s|a|b|", true},
+		{"s→a→b→", true},
+		// the rest is checked by Parse
+		{"s/a/", true},
+		{"s/a", false},
+		{"s/", false},
+		{"sim", false},
+		{"sus", false},
+		{"s a b", false},
+		{"x/a/b/", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := IsScript(test.text); got != test.want {
+			t.Fatalf("%q - want: %v, got: %v", test.text, test.want, got)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		// part of the error message
+		want string
+	}{
+		{"empty", "", "nenhum comando"},
+		{"only semicolons", " ; ;", "nenhum comando"},
+		{"unknown command", "d", "comando desconhecido"},
+		{"missing delimiter", "s", "faltou o resto do s"},
+		{"backslash delimiter", `s\a\b\`, "não pode separar"},
+		{"letter delimiter", "sxaxbx", "não pode separar"},
+		{"unterminated pattern", "s/abc", "faltou fechar o s com /"},
+		{"unterminated replacement", "s/a/b", "faltou fechar o s com /"},
+		{"unterminated by escape", `s/a/b\/`, "faltou fechar o s com /"},
+		{"unknown flag", "s/a/b/x", "flag 'x' não suportada"},
+		{"print flag", "s/a/b/p", "flag 'p' não suportada"},
+		{"occurrence zero", "s/a/b/0", "ocorrência 0 não existe"},
+		{"occurrence too big", "s/a/b/999", "ocorrência 999 não existe"},
+		{"two occurrences", "s/a/b/1g2", "só pode ter um número"},
+		{"empty pattern", "s//b/", "expressão do s está vazia"},
+		{"bad parens", "s/(a/b/", "parênteses não fecham"},
+		{"bad bracket", "s/[a/b/", "faltou fechar o ["},
+		{"backreference in pattern", `s/(a)\1/b/`, `\1 não é suportado`},
+		{"nothing to repeat", "s/*a/b/", "não repete nada"},
+		{"repeat too big", "s/a{2000}/b/", "repetição grande demais"},
+		{"missing group", `s/(a)/\2/`, `\2 não existe, a expressão tem 1 grupos`},
+		{"garbage after command", "s/a/b/ c", "esperava ; depois do comando 1"},
+		{"y sizes", "y/abc/xy/", "mesmo tamanho"},
+		{"y repeated", "y/aa/bc/", "'a' aparece duas vezes"},
+		{"y unterminated", "y/abc/xyz", "faltou fechar o y com /"},
+		{"second command", "s/a/b/;q", "comando desconhecido 'q'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Run(context.TODO(), test.script, "abc", DefaultLimits)
+			var sedErr *Error
+			if !errors.As(err, &sedErr) {
+				t.Fatalf("want *Error, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("want error with %q, got: %q", test.want, err)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxScriptSize:  50,
+		MaxPatternSize: 10,
+		MaxOutputSize:  100,
+		Timeout:        time.Second,
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		input  string
+		want   string
+	}{
+		{"script size", "s/a/b/;" + strings.Repeat("s/a/b/;", 10), "a", "máximo são 50 caracteres"},
+		{"pattern size", "s/" + strings.Repeat("a", 11) + "/b/", "a", "máximo são 10 caracteres"},
+		{"output of a replacement", "s/a/" + strings.Repeat("b", 20) + "/g", strings.Repeat("a", 10), ErrOutputTooLarge.Error()},
+		{"output that doubles", "s/.*/&&/;s/.*/&&/;s/.*/&&/;s/.*/&&/", strings.Repeat("a", 10), ErrOutputTooLarge.Error()},
+		{"output of many lines", "s/$/!/", strings.Repeat("aaaa\n", 25), ErrOutputTooLarge.Error()},
+		{"input too large", "s/x/y/", strings.Repeat("a", 101), ErrOutputTooLarge.Error()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Run(context.TODO(), test.script, test.input, limits)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("want error with %q, got: %v", test.want, err)
+			}
+		})
+	}
+
+	// right at the limit
+	got, err := Run(context.TODO(), "s/a/bb/g", strings.Repeat("a", 50), limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 100 {
+		t.Fatalf("output size - want: %d, got: %d", 100, len(got))
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Run(ctx, "s/a/b/", "a", DefaultLimits)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("want: %v, got: %v", ErrTimeout, err)
+	}
+
+	limits := DefaultLimits
+	limits.Timeout = time.Nanosecond
+	_, err = Run(context.Background(), "s/a/b/", "a", limits)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("want: %v, got: %v", ErrTimeout, err)
+	}
+}
+
+func TestParseOnce(t *testing.T) {
+	script, err := Parse("s/a/b/g", DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{"aa", "ab"} {
+		got, err := script.Run(context.TODO(), input, DefaultLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(got, "a") {
+			t.Fatalf("%q - want no a, got: %q", input, got)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package util
+
+// Truncate cuts s to at most max runes, ending with "..." if it was cut.
+// It never splits a multibyte character.
+func Truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	if max <= 3 {
+		return string(runes[:max])
+	}
+	return string(runes[:max-3]) + "..."
+}
@@ -0,0 +1,25 @@
+package util
+
+import "testing"
+
+func Test_Truncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 8, "hello..."},
+		{"ação ação", 6, "açã..."},
+		{"ação", 2, "aç"},
+		{"", 3, ""},
+	}
+
+	for _, tt := range tests {
+		got := Truncate(tt.s, tt.max)
+		if tt.want != got {
+			t.Errorf("Truncate(%q, %d) - want: '%s', got: '%s'", tt.s, tt.max, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func Test_CosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float32
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{-1, 0}, -1},
+		{[]float32{1, 1}, []float32{2, 2}, 1},
+		{[]float32{0, 0}, []float32{1, 1}, 0},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		got := CosineSimilarity(tt.a, tt.b)
+		if math.Abs(float64(tt.want-got)) > 1e-6 {
+			t.Errorf("%v, %v - want: %f, got: %f", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func BenchmarkCosineSimilarity(b *testing.B) {
+	// same size as text-embedding-ada-002 vectors
+	x := randomVector(1536)
+	y := randomVector(1536)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CosineSimilarity(x, y)
+	}
+}
+
+func randomVector(size int) []float32 {
+	v := make([]float32, size)
+	for i := range v {
+		v[i] = rand.Float32()*2 - 1
+	}
+	return v
+}